@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+	"github.com/spf13/cobra"
+)
+
+var diffAfter time.Duration
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the metrics of two targets, or of one target at two points in time",
+	Long: "Compare the metrics of two --url targets, such as the old and new builds of a service, " +
+		"or of one target scraped twice --after some time. Families and series that were added or removed, " +
+		"HELP and TYPE changes and changed values are reported grouped by family, with rates of counters when comparing over time.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fetchers, err := newFetchers()
+		if err != nil {
+			fmt.Printf("Error configuring targets: %v\n", err)
+			os.Exit(1)
+		}
+		diff, err := scrapeDiff(cmd.Context(), fetchers, diffAfter)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if jsonOutput {
+			jsonData, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				fmt.Printf("Error marshaling JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(jsonData))
+			return
+		}
+		if err := diff.writeText(os.Stdout); err != nil {
+			fmt.Printf("Error writing diff: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// scrapeDiff scrapes two targets at once, or one target twice after the
+// given time, and compares the scrapes
+func scrapeDiff(ctx context.Context, fetchers []*fetcher.MetricsFetcher, after time.Duration) (*metricsDiff, error) {
+	if after > 0 {
+		if len(fetchers) != 1 {
+			return nil, fmt.Errorf("diff --after compares one target over time, got %d targets", len(fetchers))
+		}
+		start := time.Now()
+		first := scrapeTargets(ctx, fetchers)[0]
+		if first.err != nil {
+			return nil, fmt.Errorf("fetching metrics from %s: %w", first.url, first.err)
+		}
+		fmt.Fprintf(os.Stderr, "Scraped %s, scraping again in %s\n", first.url, after)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(after):
+		}
+		// Rates are over the time between the starts of the scrapes
+		elapsed := time.Since(start)
+		second := scrapeTargets(ctx, fetchers)[0]
+		if second.err != nil {
+			return nil, fmt.Errorf("fetching metrics from %s: %w", second.url, second.err)
+		}
+		return diffMetrics(first, second, elapsed), nil
+	}
+
+	if len(fetchers) != 2 {
+		return nil, fmt.Errorf("diff compares two targets, or one target with --after, got %d targets", len(fetchers))
+	}
+	scrapes := scrapeTargets(ctx, fetchers)
+	for _, scrape := range scrapes {
+		if scrape.err != nil {
+			return nil, fmt.Errorf("fetching metrics from %s: %w", scrape.url, scrape.err)
+		}
+	}
+	return diffMetrics(scrapes[0], scrapes[1], 0), nil
+}
+
+// metricsDiff is the difference between two scrapes. Series are matched by
+// their name and labels, as the scrapes may come from different targets.
+type metricsDiff struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+	// Elapsed is the time between the scrapes of one target, from which
+	// rates are calculated, and zero when comparing two targets
+	Elapsed  float64      `json:"elapsed_seconds,omitempty"`
+	Families []familyDiff `json:"families"`
+}
+
+// familyDiff is the difference in one metric family. Families without any
+// differences are left out of a diff.
+type familyDiff struct {
+	Name          string        `json:"name"`
+	Added         bool          `json:"added,omitempty"`   // the family is only in the second scrape
+	Removed       bool          `json:"removed,omitempty"` // the family is only in the first scrape
+	Help          *stringChange `json:"help,omitempty"`
+	Type          *stringChange `json:"type,omitempty"`
+	AddedSeries   []string      `json:"added_series,omitempty"`
+	RemovedSeries []string      `json:"removed_series,omitempty"`
+	Changes       []valueChange `json:"changes,omitempty"`
+}
+
+type stringChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// valueChange is a sample whose value changed. Histograms and summaries are
+// compared by their _count, _sum and quantiles rather than every bucket.
+type valueChange struct {
+	Sample string                  `json:"sample"`
+	Before fetcher.NullableFloat64 `json:"before"`
+	After  fetcher.NullableFloat64 `json:"after"`
+	Delta  fetcher.NullableFloat64 `json:"delta"`
+	// Rate is the per-second increase of a counter over time, treating a
+	// decrease as a reset like prometheus' rate()
+	Rate *fetcher.NullableFloat64 `json:"rate,omitempty"`
+}
+
+// diffFamily is the help, type and series of a family in one scrape
+type diffFamily struct {
+	help, metricType string
+	series           map[string]fetcher.MetricData
+}
+
+// diffFamilies groups metrics into families and their series
+func diffFamilies(metrics []fetcher.MetricData) map[string]*diffFamily {
+	families := make(map[string]*diffFamily)
+	for _, m := range metrics {
+		family, ok := families[m.Name]
+		if !ok {
+			family = &diffFamily{help: m.Help, metricType: m.Type, series: make(map[string]fetcher.MetricData)}
+			families[m.Name] = family
+		}
+		family.series[m.Series()] = m
+	}
+	return families
+}
+
+// diffMetrics compares two scrapes, calculating rates if elapsed is set
+func diffMetrics(before, after targetScrape, elapsed time.Duration) *metricsDiff {
+	diff := &metricsDiff{Before: before.url, After: after.url, Elapsed: elapsed.Seconds(), Families: []familyDiff{}}
+	beforeFamilies, afterFamilies := diffFamilies(before.data), diffFamilies(after.data)
+
+	names := slices.Concat(slices.Collect(maps.Keys(beforeFamilies)), slices.Collect(maps.Keys(afterFamilies)))
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		b, a := beforeFamilies[name], afterFamilies[name]
+		fd := familyDiff{Name: name}
+		switch {
+		case b == nil:
+			fd.Added = true
+			fd.AddedSeries = slices.Sorted(maps.Keys(a.series))
+		case a == nil:
+			fd.Removed = true
+			fd.RemovedSeries = slices.Sorted(maps.Keys(b.series))
+		default:
+			if b.help != a.help {
+				fd.Help = &stringChange{Before: b.help, After: a.help}
+			}
+			if !strings.EqualFold(b.metricType, a.metricType) {
+				fd.Type = &stringChange{Before: b.metricType, After: a.metricType}
+			}
+			for _, series := range slices.Sorted(maps.Keys(a.series)) {
+				previous, ok := b.series[series]
+				if !ok {
+					fd.AddedSeries = append(fd.AddedSeries, series)
+					continue
+				}
+				fd.Changes = append(fd.Changes, diffValues(previous, a.series[series], elapsed)...)
+			}
+			for _, series := range slices.Sorted(maps.Keys(b.series)) {
+				if _, ok := a.series[series]; !ok {
+					fd.RemovedSeries = append(fd.RemovedSeries, series)
+				}
+			}
+			if fd.Help == nil && fd.Type == nil && fd.AddedSeries == nil && fd.RemovedSeries == nil && fd.Changes == nil {
+				continue
+			}
+		}
+		diff.Families = append(diff.Families, fd)
+	}
+	return diff
+}
+
+// diffSample is a sample of a series compared by diffValues
+type diffSample struct {
+	value      float64
+	cumulative bool // whether the sample only goes up, and has a rate
+}
+
+// diffSamples flattens a series into its samples, leaving out histogram
+// buckets, which would flood the diff and are summed up by _count and _sum
+func diffSamples(m fetcher.MetricData) map[string]diffSample {
+	metricType := strings.ToUpper(m.Type)
+	samples := make(map[string]diffSample)
+	for _, s := range m.Samples() {
+		if metricType == "HISTOGRAM" || metricType == "GAUGE_HISTOGRAM" {
+			if s.Name == m.Name+"_bucket" {
+				continue
+			}
+		}
+		cumulative := metricType == "COUNTER" ||
+			((metricType == "HISTOGRAM" || metricType == "SUMMARY") && (s.Name == m.Name+"_count" || s.Name == m.Name+"_sum"))
+		samples[fetcher.MetricData{Name: s.Name, Labels: s.Labels}.Series()] = diffSample{value: s.Value, cumulative: cumulative}
+	}
+	return samples
+}
+
+// diffValues compares the samples of a series, with the rates of cumulative
+// samples if elapsed is set
+func diffValues(before, after fetcher.MetricData, elapsed time.Duration) []valueChange {
+	beforeSamples, afterSamples := diffSamples(before), diffSamples(after)
+	var changes []valueChange
+	for _, sample := range slices.Sorted(maps.Keys(afterSamples)) {
+		previous, ok := beforeSamples[sample]
+		b, a := previous.value, afterSamples[sample].value
+		if !ok || a == b || (math.IsNaN(a) && math.IsNaN(b)) {
+			continue
+		}
+		change := valueChange{Sample: sample, Before: fetcher.NullableFloat64(b), After: fetcher.NullableFloat64(a), Delta: fetcher.NullableFloat64(a - b)}
+		if elapsed > 0 && afterSamples[sample].cumulative && previous.cumulative {
+			increase := a - b
+			if increase < 0 {
+				// The counter was reset
+				increase = a
+			}
+			rate := fetcher.NullableFloat64(increase / elapsed.Seconds())
+			change.Rate = &rate
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// writeText writes the diff for people, with a section per family marked
+// + if it was added, - if it was removed and ~ if it changed
+func (d *metricsDiff) writeText(w io.Writer) error {
+	var b strings.Builder
+	if d.Elapsed > 0 {
+		fmt.Fprintf(&b, "Comparing %s over %s\n", d.After, time.Duration(d.Elapsed*float64(time.Second)).Round(time.Millisecond))
+	} else {
+		fmt.Fprintf(&b, "Comparing %s with %s\n", d.Before, d.After)
+	}
+
+	var added, removed, changed int
+	for _, family := range d.Families {
+		b.WriteString("\n")
+		switch {
+		case family.Added:
+			added++
+			fmt.Fprintf(&b, "+ %s\n", family.Name)
+		case family.Removed:
+			removed++
+			fmt.Fprintf(&b, "- %s\n", family.Name)
+		default:
+			changed++
+			fmt.Fprintf(&b, "~ %s\n", family.Name)
+		}
+		if family.Help != nil {
+			fmt.Fprintf(&b, "    HELP %q -> %q\n", family.Help.Before, family.Help.After)
+		}
+		if family.Type != nil {
+			fmt.Fprintf(&b, "    TYPE %s -> %s\n", strings.ToLower(family.Type.Before), strings.ToLower(family.Type.After))
+		}
+		for _, series := range family.AddedSeries {
+			fmt.Fprintf(&b, "  + %s\n", series)
+		}
+		for _, series := range family.RemovedSeries {
+			fmt.Fprintf(&b, "  - %s\n", series)
+		}
+		for _, change := range family.Changes {
+			delta := strconv.FormatFloat(float64(change.Delta), 'g', -1, 64)
+			if change.Delta > 0 && !math.IsInf(float64(change.Delta), 1) {
+				// FormatFloat already writes +Inf with its sign
+				delta = "+" + delta
+			}
+			fmt.Fprintf(&b, "    %s %s -> %s (%s", change.Sample,
+				strconv.FormatFloat(float64(change.Before), 'g', -1, 64), strconv.FormatFloat(float64(change.After), 'g', -1, 64), delta)
+			if change.Rate != nil {
+				fmt.Fprintf(&b, ", %.4g/s", float64(*change.Rate))
+			}
+			b.WriteString(")\n")
+		}
+	}
+
+	if len(d.Families) == 0 {
+		b.WriteString("\nNo differences\n")
+	} else {
+		fmt.Fprintf(&b, "\nFamilies: %d added, %d removed, %d changed\n", added, removed, changed)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+func TestDiffMetrics(t *testing.T) {
+	count, sum := uint64(10), fetcher.NullableFloat64(2)
+	newCount, newSum := uint64(15), fetcher.NullableFloat64(2.5)
+	histogram := func(count *uint64, sum *fetcher.NullableFloat64, inf uint64) fetcher.MetricData {
+		return fetcher.MetricData{Name: "latency_seconds", Type: "HISTOGRAM", SampleCount: count, SampleSum: sum,
+			Buckets: []fetcher.HistogramBucket{{UpperBound: 0.1, CumulativeCount: inf - 1}}}
+	}
+	before := targetScrape{url: "http://old/metrics", data: []fetcher.MetricData{
+		{Name: "http_requests_total", Type: "COUNTER", Help: "Requests.", Labels: map[string]string{"code": "200"}, Value: 100},
+		{Name: "http_requests_total", Type: "COUNTER", Help: "Requests.", Labels: map[string]string{"code": "404"}, Value: 5},
+		{Name: "queue_length", Type: "GAUGE", Value: 3},
+		{Name: "old_metric", Type: "GAUGE", Value: 1},
+		{Name: "unchanged", Type: "GAUGE", Value: 7},
+		histogram(&count, &sum, count),
+	}}
+	after := targetScrape{url: "http://old/metrics", data: []fetcher.MetricData{
+		{Name: "http_requests_total", Type: "COUNTER", Help: "HTTP requests.", Labels: map[string]string{"code": "200"}, Value: 130},
+		{Name: "http_requests_total", Type: "COUNTER", Help: "HTTP requests.", Labels: map[string]string{"code": "500"}, Value: 1},
+		{Name: "queue_length", Type: "UNTYPED", Value: 1},
+		{Name: "new_metric", Type: "COUNTER", Labels: map[string]string{"a": "b"}, Value: 1},
+		{Name: "unchanged", Type: "GAUGE", Value: 7},
+		histogram(&newCount, &newSum, newCount),
+	}}
+
+	diff := diffMetrics(before, after, 10*time.Second)
+	var text bytes.Buffer
+	if err := diff.writeText(&text); err != nil {
+		t.Fatal(err)
+	}
+	expected := `Comparing http://old/metrics over 10s
+
+~ http_requests_total
+    HELP "Requests." -> "HTTP requests."
+  + http_requests_total{code="500"}
+  - http_requests_total{code="404"}
+    http_requests_total{code="200"} 100 -> 130 (+30, 3/s)
+
+~ latency_seconds
+    latency_seconds_count 10 -> 15 (+5, 0.5/s)
+    latency_seconds_sum 2 -> 2.5 (+0.5, 0.05/s)
+
++ new_metric
+  + new_metric{a="b"}
+
+- old_metric
+  - old_metric
+
+~ queue_length
+    TYPE gauge -> untyped
+    queue_length 3 -> 1 (-2)
+
+Families: 1 added, 1 removed, 3 changed
+`
+	if got := text.String(); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// The JSON output has the same differences
+	jsonData, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded metricsDiff
+	if err := json.Unmarshal(jsonData, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Families) != 5 || decoded.Elapsed != 10 || decoded.Families[0].Changes[0].Rate == nil {
+		t.Errorf("Unexpected JSON %s", jsonData)
+	}
+}
+
+func TestDiffMetrics_TwoTargets(t *testing.T) {
+	before := targetScrape{url: "http://a/metrics", data: []fetcher.MetricData{
+		{Name: "requests_total", Type: "COUNTER", Value: 5, Source: "http://a/metrics"},
+		{Name: "temperature", Type: "GAUGE", Value: 1, Source: "http://a/metrics"},
+	}}
+	after := targetScrape{url: "http://b/metrics", data: []fetcher.MetricData{
+		{Name: "requests_total", Type: "COUNTER", Value: 2, Source: "http://b/metrics"},
+		{Name: "temperature", Type: "GAUGE", Value: 1, Source: "http://b/metrics"},
+	}}
+
+	// Series match despite the different sources, and there are no rates
+	diff := diffMetrics(before, after, 0)
+	var text bytes.Buffer
+	if err := diff.writeText(&text); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Comparing http://a/metrics with http://b/metrics\n\n~ requests_total\n    requests_total 5 -> 2 (-3)\n\nFamilies: 0 added, 0 removed, 1 changed\n"
+	if got := text.String(); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	var same bytes.Buffer
+	if err := diffMetrics(before, before, 0).writeText(&same); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(same.String(), "\nNo differences\n") {
+		t.Errorf("Expected no differences, got:\n%s", same.String())
+	}
+}
+
+func TestDiffMetrics_Infinities(t *testing.T) {
+	before := targetScrape{url: "http://a/metrics", data: []fetcher.MetricData{
+		{Name: "limit", Type: "GAUGE", Value: 1},
+		{Name: "floor", Type: "GAUGE", Value: 1},
+	}}
+	after := targetScrape{url: "http://b/metrics", data: []fetcher.MetricData{
+		{Name: "limit", Type: "GAUGE", Value: fetcher.NullableFloat64(math.Inf(1))},
+		{Name: "floor", Type: "GAUGE", Value: fetcher.NullableFloat64(math.Inf(-1))},
+	}}
+	diff := diffMetrics(before, after, 0)
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatalf("failed to marshal a diff with infinite values: %v", err)
+	}
+	var decoded metricsDiff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", data, err)
+	}
+	if len(decoded.Families) != 2 {
+		t.Fatalf("expected 2 changed families, got %s", data)
+	}
+	floor, limit := decoded.Families[0].Changes[0], decoded.Families[1].Changes[0]
+	if !math.IsInf(float64(limit.After), 1) || !math.IsInf(float64(limit.Delta), 1) ||
+		!math.IsInf(float64(floor.After), -1) || !math.IsInf(float64(floor.Delta), -1) {
+		t.Errorf("expected infinite values and deltas to round trip, got %s", data)
+	}
+
+	var text bytes.Buffer
+	if err := diff.writeText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "limit 1 -> +Inf (+Inf)") || !strings.Contains(text.String(), "floor 1 -> -Inf (-Inf)") {
+		t.Errorf("unexpected text:\n%s", text.String())
+	}
+}
+
+func TestScrapeDiff_After(t *testing.T) {
+	var scrapes atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := scrapes.Add(1)
+		fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total %d\n", n*10)
+	}))
+	defer server.Close()
+
+	f := fetcher.New(server.URL, nil)
+	diff, err := scrapeDiff(t.Context(), []*fetcher.MetricsFetcher{f}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Families) != 1 || len(diff.Families[0].Changes) != 1 {
+		t.Fatalf("Expected one change, got %+v", diff.Families)
+	}
+	change := diff.Families[0].Changes[0]
+	if change.Before != 10 || change.After != 20 || change.Rate == nil || diff.Elapsed < 0.01 {
+		t.Errorf("Unexpected change %+v over %gs", change, diff.Elapsed)
+	}
+
+	if _, err := scrapeDiff(t.Context(), []*fetcher.MetricsFetcher{f, f}, time.Second); err == nil {
+		t.Error("Expected an error comparing two targets over time")
+	}
+	if _, err := scrapeDiff(t.Context(), []*fetcher.MetricsFetcher{f}, 0); err == nil {
+		t.Error("Expected an error comparing one target without --after")
+	}
+}
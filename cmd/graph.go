@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,28 +23,85 @@ import (
 // Message types for dashboard polling
 type tickMsg time.Time
 type metricsMsg struct {
-	data []fetcher.MetricData
-	err  error
+	data    []fetcher.MetricData
+	err     error          // set if every target failed
+	targets []targetScrape // outcome of each target's scrape
+	// time the scrapes started, from which rates are calculated. Update
+	// uses the time it receives the message if it is zero.
+	time time.Time
 }
 
 // metricGraph holds the data and chart for a single metric
 type metricGraph struct {
-	name     string
-	buffer   *buffer.RingBuffer
-	chart    timeserieslinechart.Model
-	color    lipgloss.Color
-	interval time.Duration
+	name   string
+	buffer *buffer.TimestampedBuffer
+	chart  timeserieslinechart.Model
+	color  lipgloss.Color
+
+	// raw holds the scraped values of a counter, whose per-second rate is
+	// plotted in buffer. It is nil for other metric types.
+	raw *buffer.TimestampedBuffer
+
+	// segment counts failed scrapes. Points after a gap are drawn as a new
+	// data set, so that no line is drawn across the gap.
+	segment int
+
+	// family graphs plot one line per series of the metric family called name
+	family bool
+
+	// lines are plotted instead of buffer when a metric is drawn as several
+	// lines, such as the series of a family or the quantiles of a native histogram
+	lines []*graphLine
+
+	// natives holds the previous scrape of native histograms by series
+	// identifier, to plot quantiles of the observations made since
+	natives map[string]fetcher.NativeHistogram
+
+	// histograms holds the bucket deltas of classic histograms by series
+	// identifier. Their quantiles are plotted over the merged window.
+	histograms map[string]*buffer.HistogramBuffer
+
+	// summaries holds the previous scrape of summaries by series identifier,
+	// to average the observations made since
+	summaries map[string]fetcher.MetricData
+}
+
+// graphLine is one named line on a chart with several lines
+type graphLine struct {
+	name   string
+	buffer *buffer.TimestampedBuffer
+	raw    *buffer.TimestampedBuffer // scraped counter values, as in metricGraph
+	color  lipgloss.Color
 }
 
-// metricItem implements list.Item for MetricData
+// histogramQuantiles are the quantiles plotted for histograms
+var histogramQuantiles = []float64{0.5, 0.9, 0.99}
+
+// maxLegendLines caps the legend of a graph with many lines
+const maxLegendLines = 6
+
+// metricItem implements list.Item for MetricData. Family items stand for
+// every series of the metric family named metric.Name.
 type metricItem struct {
 	metric   fetcher.MetricData
+	family   bool
+	series   int // number of series in a family
 	selected bool
 }
 
-func (i metricItem) FilterValue() string { return i.metric.Identifier() }
+func (i metricItem) FilterValue() string {
+	if i.family {
+		return i.metric.Name
+	}
+	return i.metric.Identifier()
+}
 
-func (i metricItem) Title() string { return i.metric.Identifier() }
+func (i metricItem) Title() string {
+	if i.family {
+		return fmt.Sprintf("%s (all %d series)", i.metric.Name, i.series)
+	}
+	return i.metric.Identifier()
+}
 
 func (i metricItem) Description() string {
 	selected := " "
@@ -85,15 +144,21 @@ func (m *metricSelectionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.list.SetItem(m.list.Index(), selectedItem)
 			}
 		case "enter":
-			// Proceed to graph view with selected metrics
-			var selectedMetrics []string
+			// Proceed to graph view with selected series and families
+			var series, families []string
 			for _, item := range m.list.Items() {
-				if metricItem, ok := item.(metricItem); ok && metricItem.selected {
-					selectedMetrics = append(selectedMetrics, metricItem.metric.Name)
+				metricItem, ok := item.(metricItem)
+				if !ok || !metricItem.selected {
+					continue
+				}
+				if metricItem.family {
+					families = append(families, metricItem.metric.Name)
+				} else {
+					series = append(series, metricItem.metric.Identifier())
 				}
 			}
-			if len(selectedMetrics) > 0 {
-				dm := newDashboardModel(selectedMetrics, m.fetchers, m.interval, m.width, m.height)
+			if len(series)+len(families) > 0 {
+				dm := newDashboardModel(series, families, m.fetchers, m.interval, m.width, m.height)
 				return dm, dm.Init()
 			}
 		}
@@ -108,7 +173,8 @@ func (m *metricSelectionModel) View() string {
 	return "\n" + m.list.View()
 }
 
-// dashboardModel represents the dashboard view with live-updating charts
+// dashboardModel represents the dashboard view with live-updating charts.
+// Graphs are keyed by series identifier, or by name for family graphs.
 type dashboardModel struct {
 	selectedMetrics []string
 	graphs          map[string]*metricGraph
@@ -118,6 +184,8 @@ type dashboardModel struct {
 	interval        time.Duration
 	lastFetch       time.Time
 	lastError       error
+	health          map[string]*targetHealth // by target URL
+	heatmaps        bool                     // show histograms as heatmaps instead of quantile lines
 }
 
 // chartColors defines a palette of colors for different metrics
@@ -174,10 +242,14 @@ func (m dashboardModel) calculateGrid() (cols, rows int) {
 	return cols, rows
 }
 
-func newDashboardModel(metrics []string, fetchers []*fetcher.MetricsFetcher, interval time.Duration, width, height int) dashboardModel {
+// newDashboardModel creates a dashboard with one graph per selected series
+// identifier and one shared graph per selected family name
+func newDashboardModel(series, families []string, fetchers []*fetcher.MetricsFetcher, interval time.Duration, width, height int) dashboardModel {
+	metrics := append(slices.Clip(series), families...)
 	m := dashboardModel{
 		selectedMetrics: metrics,
 		graphs:          make(map[string]*metricGraph),
+		health:          make(map[string]*targetHealth),
 		fetchers:        fetchers,
 		interval:        interval,
 		width:           width,
@@ -209,14 +281,14 @@ func newDashboardModel(metrics []string, fetchers []*fetcher.MetricsFetcher, int
 			timeserieslinechart.WithXLabelFormatter(timeserieslinechart.HourTimeLabelFormatter()),
 		)
 		chart.SetStyle(lipgloss.NewStyle().Foreground(color))
-		chart.DrawBraille()
+		chart.DrawBrailleAll()
 		drawGridLines(&chart)
 		m.graphs[name] = &metricGraph{
-			name:     name,
-			buffer:   buffer.New(30),
-			chart:    chart,
-			color:    color,
-			interval: interval,
+			name:   name,
+			buffer: buffer.NewTimestamped(30),
+			chart:  chart,
+			color:  color,
+			family: i >= len(series),
 		}
 	}
 	return m
@@ -228,22 +300,21 @@ func (m dashboardModel) pollTick() tea.Cmd {
 	})
 }
 
+// fetchMetrics scrapes every target in parallel. The next poll is only
+// scheduled once every scrape finished or timed out.
 func (m dashboardModel) fetchMetrics() tea.Cmd {
 	return func() tea.Msg {
-		var allData []fetcher.MetricData
-		for _, f := range m.fetchers {
-			data, err := f.Fetch()
-			if err != nil {
-				return metricsMsg{data: nil, err: err}
-			}
-			allData = append(allData, data...)
-		}
-		return metricsMsg{data: allData, err: nil}
+		start := time.Now()
+		msg := newMetricsMsg(scrapeTargets(context.Background(), m.fetchers))
+		msg.time = start
+		return msg
 	}
 }
 
+// Init starts the only chain of scrapes: each scrape schedules a tick, and
+// each tick the next scrape
 func (m dashboardModel) Init() tea.Cmd {
-	return tea.Batch(m.pollTick(), m.fetchMetrics())
+	return m.fetchMetrics()
 }
 
 func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -252,6 +323,8 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "h":
+			m.heatmaps = !m.heatmaps
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -272,32 +345,40 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			for _, graph := range m.graphs {
 				graph.chart.Resize(chartWidth, chartHeight)
-				graph.chart.DrawBraille()
-				drawGridLines(&graph.chart)
+				graph.draw()
 			}
 		}
 	case tickMsg:
 		return m, m.fetchMetrics()
 	case metricsMsg:
-		m.lastFetch = time.Now()
+		m.lastFetch = msg.time
+		if m.lastFetch.IsZero() {
+			m.lastFetch = time.Now()
+		}
+		updateHealth(m.health, msg.targets, m.lastFetch)
 		if msg.err != nil {
 			m.lastError = msg.err
+			for _, graph := range m.graphs {
+				graph.gap(m.lastFetch)
+			}
 		} else {
 			m.lastError = nil
+			scraped := make(map[*metricGraph]bool)
 			for _, metric := range msg.data {
-				if graph, ok := m.graphs[metric.Name]; ok {
-					value := float64(metric.Value)
-					// Skip NaN/Inf values
-					if math.IsNaN(value) || math.IsInf(value, 0) {
-						continue
-					}
-					graph.buffer.Push(value)
-					graph.chart.Push(timeserieslinechart.TimePoint{
-						Time:  m.lastFetch,
-						Value: value,
-					})
-					graph.chart.DrawBraille()
-					drawGridLines(&graph.chart)
+				if graph, ok := m.graphs[metric.Identifier()]; ok && !graph.family {
+					graph.push(metric, m.lastFetch)
+					scraped[graph] = true
+				}
+				if graph, ok := m.graphs[metric.Name]; ok && graph.family {
+					graph.pushSeries(metric, m.seriesLabel(metric), m.lastFetch)
+					scraped[graph] = true
+				}
+			}
+			for _, graph := range m.graphs {
+				graph.plotHistogramQuantiles(m.lastFetch)
+				// Series of targets that failed this time leave a gap
+				if !scraped[graph] && m.anyTargetDown() {
+					graph.gap(m.lastFetch)
 				}
 			}
 		}
@@ -306,6 +387,335 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// anyTargetDown reports whether the most recent scrape of any target failed
+func (m dashboardModel) anyTargetDown() bool {
+	for _, h := range m.health {
+		if !h.up {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesLabel names a series within its family graph: its labels, and its
+// source when scraping more than one target
+func (m dashboardModel) seriesLabel(metric fetcher.MetricData) string {
+	label := strings.TrimPrefix(metric.Series(), metric.Name)
+	if label == "" {
+		label = "{}"
+	}
+	if len(m.fetchers) > 1 {
+		label += "@" + metric.Source
+	}
+	return label
+}
+
+// push plots a scraped value of the graph's series
+func (g *metricGraph) push(metric fetcher.MetricData, t time.Time) {
+	if metric.NativeHistogram != nil {
+		g.pushNativeHistogram(metric, "", t)
+		return
+	}
+	if isHistogram(metric) {
+		g.pushHistogram(metric, t)
+		return
+	}
+	if isSummary(metric) {
+		g.pushSummary(metric, "", t)
+		return
+	}
+	value := float64(metric.Value)
+	// Skip NaN/Inf values
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if isCounter(metric) {
+		if g.raw == nil {
+			g.raw = buffer.NewTimestamped(g.buffer.Capacity())
+		}
+		var ok bool
+		if value, ok = perSecond(g.raw, t, value); !ok {
+			return
+		}
+	}
+	g.buffer.Push(t, value)
+	g.pushPoint(nil, t, value)
+	g.draw()
+}
+
+// pushSeries plots a scraped value of one series of a family graph on the
+// line called label, adding the line the first time the series is seen
+func (g *metricGraph) pushSeries(metric fetcher.MetricData, label string, t time.Time) {
+	if metric.NativeHistogram != nil {
+		g.pushNativeHistogram(metric, label+" ", t)
+		return
+	}
+	if isHistogram(metric) {
+		g.pushHistogram(metric, t)
+		return
+	}
+	if isSummary(metric) {
+		g.pushSummary(metric, label+" ", t)
+		return
+	}
+	value := float64(metric.Value)
+	// Skip NaN/Inf values
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	line := g.line(label)
+	if line == nil {
+		line = g.addLine(label, len(g.lines))
+	}
+	if isCounter(metric) {
+		if line.raw == nil {
+			line.raw = buffer.NewTimestamped(line.buffer.Capacity())
+		}
+		var ok bool
+		if value, ok = perSecond(line.raw, t, value); !ok {
+			return
+		}
+	}
+	line.buffer.Push(t, value)
+	g.pushPoint(line, t, value)
+	g.draw()
+}
+
+// isHistogram reports whether a metric is a classic histogram, whose
+// quantiles are plotted
+func isHistogram(metric fetcher.MetricData) bool {
+	return strings.EqualFold(metric.Type, "HISTOGRAM") && len(metric.Buckets) > 0
+}
+
+// histogramBuckets converts a histogram's buckets, adding the +Inf bucket if
+// the exposition format left it implicit
+func histogramBuckets(metric fetcher.MetricData) []buffer.Bucket {
+	var buckets []buffer.Bucket
+	for _, b := range metric.Buckets {
+		buckets = append(buckets, buffer.Bucket{UpperBound: float64(b.UpperBound), Count: float64(b.CumulativeCount)})
+	}
+	if !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) && metric.SampleCount != nil {
+		buckets = append(buckets, buffer.Bucket{UpperBound: math.Inf(1), Count: float64(*metric.SampleCount)})
+	}
+	return buckets
+}
+
+// pushHistogram records the buckets of a classic histogram series scraped at
+// t. They are plotted by plotHistogramQuantiles once the whole scrape is recorded.
+func (g *metricGraph) pushHistogram(metric fetcher.MetricData, t time.Time) {
+	if g.histograms == nil {
+		g.histograms = make(map[string]*buffer.HistogramBuffer)
+	}
+	id := metric.Identifier()
+	hb, ok := g.histograms[id]
+	if !ok {
+		hb = buffer.NewHistogram(g.buffer.Capacity())
+		g.histograms[id] = hb
+	}
+	hb.Push(t, histogramBuckets(metric))
+}
+
+// plotHistogramQuantiles plots quantiles of the observations the graph's
+// classic histograms received over the window. The histograms of a family
+// are added up first, like histogram_quantile(q, sum by (le) (rate(...))).
+func (g *metricGraph) plotHistogramQuantiles(t time.Time) {
+	if len(g.histograms) == 0 {
+		return
+	}
+	var windows [][]buffer.Bucket
+	for _, hb := range g.histograms {
+		windows = append(windows, hb.Window())
+	}
+	merged := buffer.MergeBuckets(windows...)
+	if merged == nil {
+		return
+	}
+	for i, line := range g.quantileLines() {
+		value := buffer.BucketQuantile(histogramQuantiles[i], merged)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		line.buffer.Push(t, value)
+		g.pushPoint(line, t, value)
+	}
+	g.draw()
+}
+
+// quantileLines returns one line per histogram quantile, adding them the first time
+func (g *metricGraph) quantileLines() []*graphLine {
+	if g.lines == nil {
+		for i, q := range histogramQuantiles {
+			g.addLine(quantileName(q), i)
+		}
+	}
+	return g.lines
+}
+
+// quantileName names the line of a quantile, such as p99 for 0.99
+func quantileName(q float64) string {
+	return fmt.Sprintf("p%g", q*100)
+}
+
+// isSummary reports whether a metric is a summary, whose quantiles are plotted
+func isSummary(metric fetcher.MetricData) bool {
+	return strings.EqualFold(metric.Type, "SUMMARY")
+}
+
+// pushSummary plots one line per quantile of a summary series, and a line
+// with the average observation since the previous scrape. Line names start
+// with prefix, to tell apart the series of a family.
+func (g *metricGraph) pushSummary(metric fetcher.MetricData, prefix string, t time.Time) {
+	for _, q := range metric.Quantiles {
+		value := float64(q.Value)
+		// Quantiles are NaN while a summary has no recent observations
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		g.pushLine(prefix+quantileName(float64(q.Quantile)), t, value)
+	}
+	if avg, ok := g.summaryAverage(metric); ok {
+		g.pushLine(prefix+"avg", t, avg)
+	}
+	g.draw()
+}
+
+// summaryAverage returns the average observation of a summary series since
+// its previous scrape, like rate(sum) / rate(count). If the summary was
+// reset, its totals are all observations since.
+func (g *metricGraph) summaryAverage(metric fetcher.MetricData) (float64, bool) {
+	if metric.SampleCount == nil || metric.SampleSum == nil {
+		return 0, false
+	}
+	if g.summaries == nil {
+		g.summaries = make(map[string]fetcher.MetricData)
+	}
+	id := metric.Identifier()
+	prev, ok := g.summaries[id]
+	g.summaries[id] = metric
+	if !ok {
+		return 0, false
+	}
+
+	count := float64(*metric.SampleCount)
+	sum := float64(*metric.SampleSum)
+	if *metric.SampleCount >= *prev.SampleCount {
+		count -= float64(*prev.SampleCount)
+		sum -= float64(*prev.SampleSum)
+	}
+	if count == 0 || math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return 0, false
+	}
+	return sum / count, true
+}
+
+// pushLine plots a value on the line called name, adding it if it's new
+func (g *metricGraph) pushLine(name string, t time.Time, value float64) {
+	line := g.line(name)
+	if line == nil {
+		line = g.addLine(name, len(g.lines))
+	}
+	line.buffer.Push(t, value)
+	g.pushPoint(line, t, value)
+}
+
+// isCounter reports whether a metric is plotted as a per-second rate
+func isCounter(metric fetcher.MetricData) bool {
+	return strings.EqualFold(metric.Type, "COUNTER")
+}
+
+// perSecond records a counter value in raw and returns the per-second rate
+// since the previous value, allowing for counter resets
+func perSecond(raw *buffer.TimestampedBuffer, t time.Time, value float64) (float64, bool) {
+	raw.Push(t, value)
+	return buffer.IRate(raw.Samples())
+}
+
+// pushPoint plots a value on a line, or on the graph's own line if line is nil
+func (g *metricGraph) pushPoint(line *graphLine, t time.Time, value float64) {
+	name := timeserieslinechart.DefaultDataSetName
+	if line != nil {
+		name = line.name
+	}
+	if g.segment > 0 {
+		name = fmt.Sprintf("%s#%d", name, g.segment)
+	}
+	if line != nil {
+		g.chart.SetDataSetStyle(name, lipgloss.NewStyle().Foreground(line.color))
+	}
+	g.chart.PushDataSet(name, timeserieslinechart.TimePoint{Time: t, Value: value})
+}
+
+// gap records a failed scrape at t, which shows as a break in every line
+func (g *metricGraph) gap(t time.Time) {
+	g.buffer.PushGap(t)
+	if g.raw != nil {
+		g.raw.PushGap(t)
+	}
+	for _, line := range g.lines {
+		line.buffer.PushGap(t)
+		if line.raw != nil {
+			line.raw.PushGap(t)
+		}
+	}
+	g.segment++
+}
+
+// line returns the line called name, or nil if there is none
+func (g *metricGraph) line(name string) *graphLine {
+	for _, line := range g.lines {
+		if line.name == name {
+			return line
+		}
+	}
+	return nil
+}
+
+// draw redraws every line of the chart along with the grid
+func (g *metricGraph) draw() {
+	g.chart.DrawBrailleAll()
+	drawGridLines(&g.chart)
+}
+
+// pushNativeHistogram plots quantiles of the observations a native histogram
+// series received since its previous scrape. Line names start with prefix,
+// to tell apart the series of a family.
+func (g *metricGraph) pushNativeHistogram(metric fetcher.MetricData, prefix string, t time.Time) {
+	if g.natives == nil {
+		g.natives = make(map[string]fetcher.NativeHistogram)
+	}
+	id := metric.Identifier()
+	prev, ok := g.natives[id]
+	g.natives[id] = *metric.NativeHistogram
+	if !ok {
+		return
+	}
+	delta := metric.NativeHistogram.Sub(prev)
+	if delta.Count() == 0 {
+		return
+	}
+
+	for _, q := range histogramQuantiles {
+		value := delta.Quantile(q)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		g.pushLine(prefix+quantileName(q), t, value)
+	}
+	g.draw()
+}
+
+// addLine adds a named line, colored with the i-th palette color after the graph's own
+func (g *metricGraph) addLine(name string, i int) *graphLine {
+	base := slices.Index(chartColors, g.color)
+	line := &graphLine{
+		name:   name,
+		buffer: buffer.NewTimestamped(g.buffer.Capacity()),
+		color:  chartColors[(base+i)%len(chartColors)],
+	}
+	g.lines = append(g.lines, line)
+	return line
+}
+
 // trendArrow returns a colored arrow based on the trend direction
 func trendArrow(trend int) string {
 	switch trend {
@@ -329,11 +739,24 @@ func (m dashboardModel) renderMetricCell(name string) string {
 	labelStyle := lipgloss.NewStyle().Foreground(graph.color).Bold(true)
 	statsStyle := lipgloss.NewStyle().Foreground(graph.color)
 
+	if m.heatmaps && len(graph.histograms) > 0 {
+		hm := newHistogramHeatmap(graph.histograms)
+		return labelStyle.Render(name) + "\n" + heatmapLegend(hm) + "\n" +
+			hm.Render(graph.chart.Width(), graph.chart.Height())
+	}
+	if len(graph.lines) > 0 {
+		return labelStyle.Render(name) + "\n" + renderLegend(graph.lines) + "\n" + graph.chart.View()
+	}
+
 	var result string
 	if val, ok := graph.buffer.Latest(); ok {
 		// First line: metric name and current value with trend
 		trend := graph.buffer.Trend()
-		result = labelStyle.Render(fmt.Sprintf("%s: %.2f %s", name, val, trendArrow(trend)))
+		unit := ""
+		if graph.raw != nil {
+			unit = "/s"
+		}
+		result = labelStyle.Render(fmt.Sprintf("%s: %.2f%s %s", name, val, unit, trendArrow(trend)))
 
 		// Second line: basic statistics
 		if min, ok := graph.buffer.Min(); ok {
@@ -361,7 +784,12 @@ func (m dashboardModel) renderMetricCell(name string) string {
 		if p95, ok := graph.buffer.Percentile(95); ok {
 			advStats = append(advStats, fmt.Sprintf("p95: %.1f", p95))
 		}
-		if rate, ok := graph.buffer.Rate(graph.interval); ok {
+		if graph.raw != nil {
+			// Counters already plot their rate, so show how much they increased
+			if increase, ok := buffer.Increase(graph.raw.Samples()); ok {
+				advStats = append(advStats, fmt.Sprintf("increase: %.2f", increase))
+			}
+		} else if rate, ok := graph.buffer.Rate(); ok {
 			if rate >= 0 {
 				advStats = append(advStats, fmt.Sprintf("rate: +%.2f/s", rate))
 			} else {
@@ -378,6 +806,35 @@ func (m dashboardModel) renderMetricCell(name string) string {
 	return result + "\n" + graph.chart.View()
 }
 
+// renderLegend renders one line per chart line, with its latest value and basic statistics
+func renderLegend(lines []*graphLine) string {
+	var legend []string
+	for i, line := range lines {
+		if i == maxLegendLines && len(lines) > maxLegendLines+1 {
+			legend = append(legend, fmt.Sprintf("  … and %d more", len(lines)-i))
+			break
+		}
+		style := lipgloss.NewStyle().Foreground(line.color)
+		val, ok := line.buffer.Latest()
+		if !ok {
+			legend = append(legend, style.Render(fmt.Sprintf("■ %s: (no data)", line.name)))
+			continue
+		}
+		unit := ""
+		if line.raw != nil {
+			unit = "/s"
+		}
+		entry := fmt.Sprintf("■ %s: %.3g%s %s", line.name, val, unit, trendArrow(line.buffer.Trend()))
+		if min, ok := line.buffer.Min(); ok {
+			max, _ := line.buffer.Max()
+			avg, _ := line.buffer.Avg()
+			entry += fmt.Sprintf(" | min: %.3g | max: %.3g | avg: %.3g", min, max, avg)
+		}
+		legend = append(legend, style.Render(entry))
+	}
+	return strings.Join(legend, "\n")
+}
+
 func (m dashboardModel) View() string {
 	s := "Dashboard\n"
 	s += fmt.Sprintf("Terminal: %dx%d | ", m.width, m.height)
@@ -387,7 +844,10 @@ func (m dashboardModel) View() string {
 	cols, _ := m.calculateGrid()
 	s += fmt.Sprintf("Metrics: %d | Grid: %d cols\n\n", len(m.graphs), cols)
 
-	if m.lastError != nil {
+	// Target health includes their errors
+	if len(m.health) > 1 || m.anyTargetDown() {
+		s += renderTargetHealth(m.health, time.Now()) + "\n\n"
+	} else if m.lastError != nil {
 		s += fmt.Sprintf("⚠ Error: %v\n\n", m.lastError)
 	}
 
@@ -419,7 +879,7 @@ func (m dashboardModel) View() string {
 		s += strings.Join(rows, "\n\n")
 	}
 
-	s += "\n\nPress q to quit.\n"
+	s += "\n\nPress h to toggle histogram heatmaps, q to quit.\n"
 	return s
 }
 
@@ -439,26 +899,50 @@ func addPadding(cells []string) []string {
 	return padded
 }
 
+// metricItems converts metrics to list items. Each metric family with more
+// than one series is preceded by an item selecting the whole family.
+func metricItems(metrics []fetcher.MetricData) []list.Item {
+	series := make(map[string]int)
+	for _, metric := range metrics {
+		series[metric.Name]++
+	}
+
+	var items []list.Item
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		if !seen[metric.Name] && series[metric.Name] > 1 {
+			items = append(items, metricItem{
+				metric: fetcher.MetricData{Name: metric.Name, Help: metric.Help, Type: metric.Type},
+				family: true,
+				series: series[metric.Name],
+			})
+		}
+		seen[metric.Name] = true
+		items = append(items, metricItem{metric: metric})
+	}
+	return items
+}
+
 var graphCmd = &cobra.Command{
 	Use:   "graph",
 	Short: "Display metrics in a graph/TUI format",
 	Long:  "Poll prometheus metrics endpoints and display the results in a graph or TUI format.",
 	Run: func(cmd *cobra.Command, args []string) {
-		// Create fetchers for all URLs
-		var fetchers []*fetcher.MetricsFetcher
-		for _, url := range urls {
-			fetchers = append(fetchers, fetcher.New(url, metrics, labels))
+		// Create fetchers for all targets
+		fetchers, err := newFetchers()
+		if err != nil {
+			fmt.Printf("Error configuring targets: %v\n", err)
+			os.Exit(1)
 		}
 
 		// Fetch metrics from all URLs for initial picker display
 		var allMetrics []fetcher.MetricData
-		for _, f := range fetchers {
-			metricsData, err := f.Fetch()
-			if err != nil {
-				fmt.Printf("Error fetching metrics: %v\n", err)
+		for _, scrape := range scrapeTargets(cmd.Context(), fetchers) {
+			if scrape.err != nil {
+				fmt.Printf("Error fetching metrics: %v\n", scrape.err)
 				continue
 			}
-			allMetrics = append(allMetrics, metricsData...)
+			allMetrics = append(allMetrics, scrape.data...)
 		}
 
 		if len(allMetrics) == 0 {
@@ -466,14 +950,7 @@ var graphCmd = &cobra.Command{
 			return
 		}
 
-		// Convert metrics to list items
-		items := make([]list.Item, len(allMetrics))
-		for i, metric := range allMetrics {
-			items[i] = metricItem{
-				metric:   metric,
-				selected: false,
-			}
-		}
+		items := metricItems(allMetrics)
 
 		l := list.New(items, list.NewDefaultDelegate(), 80, 25)
 		l.Title = "Select metrics to graph"
@@ -481,11 +958,16 @@ var graphCmd = &cobra.Command{
 		l.SetFilteringEnabled(true)
 		l.Styles.Title = l.Styles.Title.Foreground(list.DefaultStyles().Title.GetForeground())
 
+		options := []tea.ProgramOption{tea.WithAltScreen()}
+		if slices.Contains(urls, "-") {
+			// Metrics are piped in, so read keys from the terminal instead
+			options = append(options, tea.WithInputTTY())
+		}
 		p := tea.NewProgram(&metricSelectionModel{
 			list:     l,
 			fetchers: fetchers,
 			interval: pollInterval,
-		}, tea.WithAltScreen())
+		}, options...)
 
 		if _, err := p.Run(); err != nil {
 			fmt.Printf("Error running TUI: %v\n", err)
@@ -3,8 +3,10 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,7 +15,7 @@ import (
 )
 
 func TestDashboardModel_TickMsgTriggersFetch(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	msg := tickMsg(time.Now())
 	_, cmd := model.Update(msg)
@@ -25,7 +27,7 @@ func TestDashboardModel_TickMsgTriggersFetch(t *testing.T) {
 
 func TestDashboardModel_MetricsMsgUpdatesState(t *testing.T) {
 	// Create model with initialized graphs
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	testData := []fetcher.MetricData{
 		{Name: "test_metric", Value: fetcher.NullableFloat64(42.0)},
@@ -60,7 +62,7 @@ func TestDashboardModel_MetricsMsgUpdatesState(t *testing.T) {
 }
 
 func TestDashboardModel_MetricsMsgError(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	testErr := errors.New("connection refused")
 	msg := metricsMsg{data: nil, err: testErr}
@@ -82,9 +84,28 @@ func TestDashboardModel_MetricsMsgError(t *testing.T) {
 	}
 }
 
+func TestDashboardModel_MetricsMsgErrorLeavesGap(t *testing.T) {
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
+	data := metricsMsg{data: []fetcher.MetricData{{Name: "test_metric", Value: 1}}}
+
+	for _, msg := range []metricsMsg{data, {err: errors.New("connection refused")}, data} {
+		result, _ := model.Update(msg)
+		model = result.(dashboardModel)
+	}
+
+	graph := model.graphs["test_metric"]
+	samples := graph.buffer.Samples()
+	if len(samples) != 3 || !samples[1].IsGap() {
+		t.Errorf("expected the failed scrape to be recorded as a gap, got %+v", samples)
+	}
+	if graph.segment != 1 {
+		t.Errorf("expected points after the gap in a new segment, got segment %d", graph.segment)
+	}
+}
+
 func TestDashboardModel_MetricsMsgClearsError(t *testing.T) {
 	// Start with an existing error
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 	model.lastError = errors.New("previous error")
 
 	// Send successful metrics
@@ -101,21 +122,62 @@ func TestDashboardModel_MetricsMsgClearsError(t *testing.T) {
 	}
 }
 
-func TestDashboardModel_InitReturnsBatch(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+func TestDashboardModel_InitFetches(t *testing.T) {
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
+
+	// Init scrapes straight away, rather than also starting a tick
+	if _, ok := model.Init()().(metricsMsg); !ok {
+		t.Error("expected Init to fetch metrics")
+	}
+}
+
+func TestDashboardModel_ScrapesOncePerInterval(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, "test_metric 1\n")
+	}))
+	defer server.Close()
 
-	cmd := model.Init()
+	fetchers := []*fetcher.MetricsFetcher{fetcher.New(server.URL, nil)}
+	const interval = 50 * time.Millisecond
+	var model tea.Model = newDashboardModel([]string{"test_metric"}, nil, fetchers, interval, 80, 24)
 
-	if cmd == nil {
-		t.Error("expected Init to return a batch command")
+	// Run commands concurrently as bubbletea does, for a few intervals
+	msgs := make(chan tea.Msg, 16)
+	run := func(cmd tea.Cmd) {
+		if cmd != nil {
+			go func() { msgs <- cmd() }()
+		}
+	}
+	run(model.Init())
+	deadline := time.After(5*interval + interval/2)
+	for running := true; running; {
+		select {
+		case msg := <-msgs:
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, cmd := range batch {
+					run(cmd)
+				}
+				continue
+			}
+			var cmd tea.Cmd
+			model, cmd = model.Update(msg)
+			run(cmd)
+		case <-deadline:
+			running = false
+		}
 	}
 
-	// tea.Batch returns a function, we can't easily inspect its contents
-	// but we verify it's not nil
+	// A scrape straight away, then at most one per interval. Each scrape
+	// waits for the previous one, so a slow machine only makes fewer.
+	if got := requests.Load(); got < 2 || got > 6 {
+		t.Errorf("expected one scrape per interval, 2 to 6 in total, got %d", got)
+	}
 }
 
 func TestDashboardModel_QuitOnCtrlC(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	msg := tea.KeyMsg{Type: tea.KeyCtrlC}
 	_, cmd := model.Update(msg)
@@ -127,7 +189,7 @@ func TestDashboardModel_QuitOnCtrlC(t *testing.T) {
 }
 
 func TestDashboardModel_QuitOnQ(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}}
 	_, cmd := model.Update(msg)
@@ -138,7 +200,7 @@ func TestDashboardModel_QuitOnQ(t *testing.T) {
 }
 
 func TestDashboardModel_WindowSizeUpdates(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 
 	msg := tea.WindowSizeMsg{Width: 120, Height: 40}
 	result, _ := model.Update(msg)
@@ -167,7 +229,7 @@ test_counter %d
 	defer server.Close()
 
 	// Create fetcher pointing to test server
-	f := fetcher.New(server.URL, nil, nil)
+	f := fetcher.New(server.URL, nil)
 
 	// Verify multiple fetches show increasing values
 	for i := 1; i <= 3; i++ {
@@ -188,7 +250,7 @@ test_counter %d
 }
 
 func TestDashboardModel_ViewShowsError(t *testing.T) {
-	model := newDashboardModel([]string{"test_metric"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"test_metric"}, nil, nil, time.Second, 80, 24)
 	model.width = 80
 	model.height = 24
 	model.lastError = errors.New("connection timeout")
@@ -207,13 +269,13 @@ func TestDashboardModel_ViewShowsError(t *testing.T) {
 
 func TestDashboardModel_ViewShowsMetrics(t *testing.T) {
 	// Create model with initialized graphs
-	model := newDashboardModel([]string{"cpu_usage", "memory_bytes"}, nil, time.Second, 80, 24)
+	model := newDashboardModel([]string{"cpu_usage", "memory_bytes"}, nil, nil, time.Second, 80, 24)
 	model.width = 80
 	model.height = 24
 
 	// Push some data to the graphs
-	model.graphs["cpu_usage"].buffer.Push(42.0)
-	model.graphs["memory_bytes"].buffer.Push(1024)
+	model.graphs["cpu_usage"].buffer.Push(time.Now(), 42.0)
+	model.graphs["memory_bytes"].buffer.Push(time.Now(), 1024)
 
 	view := model.View()
 
@@ -264,7 +326,7 @@ func TestDashboardModel_CalculateGrid(t *testing.T) {
 			for i := 0; i < tc.numMetrics; i++ {
 				metrics[i] = fmt.Sprintf("metric_%d", i)
 			}
-			model := newDashboardModel(metrics, nil, time.Second, tc.width, 40)
+			model := newDashboardModel(metrics, nil, nil, time.Second, tc.width, 40)
 
 			cols, rows := model.calculateGrid()
 
@@ -277,3 +339,369 @@ func TestDashboardModel_CalculateGrid(t *testing.T) {
 		})
 	}
 }
+
+func TestDashboardModel_NativeHistogramQuantiles(t *testing.T) {
+	model := newDashboardModel([]string{"rpc_latency_seconds"}, nil, nil, time.Second, 80, 24)
+
+	scrape := func(buckets ...float64) metricsMsg {
+		return metricsMsg{data: []fetcher.MetricData{{
+			Name: "rpc_latency_seconds",
+			Type: "HISTOGRAM",
+			NativeHistogram: &fetcher.NativeHistogram{
+				PositiveSpans:   []fetcher.BucketSpan{{Offset: 0, Length: uint32(len(buckets))}},
+				PositiveBuckets: buckets,
+			},
+		}}}
+	}
+
+	// The first scrape only establishes a baseline
+	updated, _ := model.Update(scrape(1, 1, 1))
+	model = updated.(dashboardModel)
+	graph := model.graphs["rpc_latency_seconds"]
+	if len(graph.lines) != 0 {
+		t.Fatalf("expected no lines after the first scrape, got %d", len(graph.lines))
+	}
+
+	// All new observations fall in the (1,2] bucket
+	updated, _ = model.Update(scrape(1, 5, 1))
+	model = updated.(dashboardModel)
+	if len(graph.lines) != len(histogramQuantiles) {
+		t.Fatalf("expected %d lines, got %d", len(histogramQuantiles), len(graph.lines))
+	}
+	for _, line := range graph.lines {
+		val, ok := line.buffer.Latest()
+		if !ok || val <= 1 || val > 2 {
+			t.Errorf("%s: expected a value in (1,2], got %f", line.name, val)
+		}
+	}
+	if graph.lines[0].name != "p50" || graph.lines[2].name != "p99" {
+		t.Errorf("unexpected line names %q, %q", graph.lines[0].name, graph.lines[2].name)
+	}
+
+	view := model.renderMetricCell("rpc_latency_seconds")
+	if !containsString(view, "p90") {
+		t.Errorf("expected legend in view, got:\n%s", view)
+	}
+}
+
+func TestDashboardModel_NativeHistogramFamily(t *testing.T) {
+	model := newDashboardModel(nil, []string{"rpc_latency_seconds"}, nil, time.Second, 80, 24)
+
+	// Native histograms without classic buckets, in the (1,2] bucket
+	series := func(method string, count float64) fetcher.MetricData {
+		return fetcher.MetricData{
+			Name:   "rpc_latency_seconds",
+			Type:   "HISTOGRAM",
+			Labels: map[string]string{"method": method},
+			NativeHistogram: &fetcher.NativeHistogram{
+				PositiveSpans:   []fetcher.BucketSpan{{Offset: 1, Length: 1}},
+				PositiveBuckets: []float64{count},
+			},
+		}
+	}
+	for _, count := range []float64{1, 5} {
+		updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{series("get", count), series("put", count)}})
+		model = updated.(dashboardModel)
+	}
+
+	graph := model.graphs["rpc_latency_seconds"]
+	if len(graph.lines) != 2*len(histogramQuantiles) {
+		t.Fatalf("expected quantile lines for each series, got %d lines", len(graph.lines))
+	}
+	if graph.lines[0].name != `{method="get"} p50` || graph.lines[5].name != `{method="put"} p99` {
+		t.Errorf("unexpected line names %q, %q", graph.lines[0].name, graph.lines[5].name)
+	}
+	for _, line := range graph.lines {
+		if val, ok := line.buffer.Latest(); !ok || val <= 1 || val > 2 {
+			t.Errorf("%s: expected a value in (1,2], got %f", line.name, val)
+		}
+	}
+}
+
+func TestDashboardModel_SeriesKeyedByIdentifier(t *testing.T) {
+	ok := fetcher.MetricData{Name: "http_requests_total", Labels: map[string]string{"code": "200"}, Source: "http://a", Value: 10}
+	failed := fetcher.MetricData{Name: "http_requests_total", Labels: map[string]string{"code": "500"}, Source: "http://a", Value: 2}
+
+	model := newDashboardModel([]string{ok.Identifier()}, nil, nil, time.Second, 80, 24)
+	updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{ok, failed}})
+	model = updated.(dashboardModel)
+
+	values := model.graphs[ok.Identifier()].buffer.Values()
+	if len(values) != 1 || values[0] != 10 {
+		t.Errorf("expected only the code=200 series to be pushed, got %v", values)
+	}
+}
+
+func TestDashboardModel_FamilyExpandsIntoLines(t *testing.T) {
+	model := newDashboardModel(nil, []string{"http_requests_total"}, nil, time.Second, 80, 24)
+	model.width = 80
+	model.height = 24
+
+	data := []fetcher.MetricData{
+		{Name: "http_requests_total", Labels: map[string]string{"code": "200"}, Source: "http://a", Value: 10},
+		{Name: "http_requests_total", Labels: map[string]string{"code": "500"}, Source: "http://a", Value: 2},
+		{Name: "other_metric", Source: "http://a", Value: 99},
+	}
+	updated, _ := model.Update(metricsMsg{data: data})
+	model = updated.(dashboardModel)
+
+	graph := model.graphs["http_requests_total"]
+	if len(graph.lines) != 2 {
+		t.Fatalf("expected one line per series, got %d", len(graph.lines))
+	}
+	if graph.lines[0].name != `{code="200"}` || graph.lines[1].name != `{code="500"}` {
+		t.Errorf("unexpected line names %q, %q", graph.lines[0].name, graph.lines[1].name)
+	}
+	if graph.lines[0].color == graph.lines[1].color {
+		t.Error("expected lines to have different colors")
+	}
+	if val, _ := graph.lines[1].buffer.Latest(); val != 2 {
+		t.Errorf("expected code=500 line to hold 2, got %f", val)
+	}
+
+	view := model.View()
+	if !containsString(view, `{code="500"}: 2`) {
+		t.Errorf("expected legend in view, got:\n%s", view)
+	}
+}
+
+func TestMetricItems(t *testing.T) {
+	items := metricItems([]fetcher.MetricData{
+		{Name: "up", Source: "http://a"},
+		{Name: "http_requests_total", Labels: map[string]string{"code": "200"}, Source: "http://a"},
+		{Name: "http_requests_total", Labels: map[string]string{"code": "500"}, Source: "http://a"},
+	})
+
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.(metricItem).Title())
+	}
+	expected := []string{
+		"up@http://a",
+		"http_requests_total (all 2 series)",
+		`http_requests_total{code="200"}@http://a`,
+		`http_requests_total{code="500"}@http://a`,
+	}
+	if fmt.Sprint(titles) != fmt.Sprint(expected) {
+		t.Errorf("expected %q, got %q", expected, titles)
+	}
+}
+
+func TestMetricGraph_CounterPlotsRate(t *testing.T) {
+	model := newDashboardModel([]string{"requests_total"}, nil, nil, time.Second, 80, 24)
+	graph := model.graphs["requests_total"]
+
+	start := time.Now()
+	for i, value := range []float64{100, 110, 5} {
+		metric := fetcher.MetricData{Name: "requests_total", Type: "COUNTER", Value: fetcher.NullableFloat64(value)}
+		graph.push(metric, start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	// The first scrape has no rate; the reset to 5 counts as an increase of 5
+	values := graph.buffer.Values()
+	if len(values) != 2 || values[0] != 1 || values[1] != 0.5 {
+		t.Errorf("expected rates [1 0.5], got %v", values)
+	}
+
+	view := model.renderMetricCell("requests_total")
+	if !containsString(view, "requests_total: 0.50/s") {
+		t.Errorf("expected rate in view, got:\n%s", view)
+	}
+	if !containsString(view, "increase: 15.00") {
+		t.Errorf("expected increase in view, got:\n%s", view)
+	}
+}
+
+func TestDashboardModel_CounterRateOverScrapes(t *testing.T) {
+	model := newDashboardModel([]string{"requests_total"}, nil, nil, 10*time.Second, 80, 24)
+
+	// Scrapes every 10s, with the counter reset before the last one
+	start := time.Now()
+	for i, value := range []float64{100, 150, 250, 250, 20} {
+		msg := metricsMsg{
+			data: []fetcher.MetricData{{Name: "requests_total", Type: "COUNTER", Value: fetcher.NullableFloat64(value)}},
+			time: start.Add(time.Duration(i) * 10 * time.Second),
+		}
+		updated, _ := model.Update(msg)
+		model = updated.(dashboardModel)
+	}
+
+	expected := []float64{5, 10, 0, 2}
+	if values := model.graphs["requests_total"].buffer.Values(); fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("expected rates %v, got %v", expected, values)
+	}
+}
+
+func TestMetricGraph_CounterFamilyPlotsRates(t *testing.T) {
+	model := newDashboardModel(nil, []string{"requests_total"}, nil, time.Second, 80, 24)
+	graph := model.graphs["requests_total"]
+
+	start := time.Now()
+	for i, value := range []float64{0, 20} {
+		metric := fetcher.MetricData{Name: "requests_total", Type: "COUNTER", Labels: map[string]string{"code": "200"}, Value: fetcher.NullableFloat64(value)}
+		graph.pushSeries(metric, model.seriesLabel(metric), start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	if len(graph.lines) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(graph.lines))
+	}
+	if val, ok := graph.lines[0].buffer.Latest(); !ok || val != 2 {
+		t.Errorf("expected rate 2, got %f", val)
+	}
+}
+
+// histogramMetric builds a classic histogram with buckets 0.1, 1 and +Inf
+func histogramMetric(labels map[string]string, counts ...uint64) fetcher.MetricData {
+	bounds := []float64{0.1, 1, math.Inf(1)}
+	metric := fetcher.MetricData{Name: "request_duration_seconds", Type: "HISTOGRAM", Labels: labels}
+	for i, c := range counts {
+		metric.Buckets = append(metric.Buckets, fetcher.HistogramBucket{
+			UpperBound:      fetcher.NullableFloat64(bounds[i]),
+			CumulativeCount: c,
+		})
+	}
+	return metric
+}
+
+func TestDashboardModel_HistogramQuantiles(t *testing.T) {
+	model := newDashboardModel([]string{"request_duration_seconds"}, nil, nil, time.Second, 80, 24)
+
+	for _, counts := range [][]uint64{{10, 10, 10}, {10, 20, 20}} {
+		updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{histogramMetric(nil, counts...)}})
+		model = updated.(dashboardModel)
+	}
+
+	graph := model.graphs["request_duration_seconds"]
+	if graph.buffer.Len() != 0 {
+		t.Errorf("expected the histogram's value not to be plotted, got %v", graph.buffer.Values())
+	}
+	if len(graph.lines) != len(histogramQuantiles) {
+		t.Fatalf("expected %d lines, got %d", len(histogramQuantiles), len(graph.lines))
+	}
+	// All 10 new observations fall in (0.1,1]
+	if p50, _ := graph.lines[0].buffer.Latest(); math.Abs(p50-0.55) > 1e-9 {
+		t.Errorf("expected p50 0.55, got %f", p50)
+	}
+}
+
+func TestDashboardModel_HistogramQuantilesOverScrapes(t *testing.T) {
+	model := newDashboardModel([]string{"request_duration_seconds"}, nil, nil, 10*time.Second, 80, 24)
+
+	// 10 observations in (0.1,1] between each of the scrapes, 10s apart
+	start := time.Now()
+	for i := range 4 {
+		count := uint64(10 * i)
+		msg := metricsMsg{
+			data: []fetcher.MetricData{histogramMetric(nil, 0, count, count)},
+			time: start.Add(time.Duration(i) * 10 * time.Second),
+		}
+		updated, _ := model.Update(msg)
+		model = updated.(dashboardModel)
+	}
+
+	// Every scrape after the first plots each quantile
+	for _, line := range model.graphs["request_duration_seconds"].lines {
+		if values := line.buffer.Values(); len(values) != 3 {
+			t.Errorf("%s: expected a point per scrape after the first, got %v", line.name, values)
+		}
+	}
+	if p50, _ := model.graphs["request_duration_seconds"].lines[0].buffer.Latest(); math.Abs(p50-0.55) > 1e-9 {
+		t.Errorf("expected p50 0.55, got %f", p50)
+	}
+}
+
+func TestDashboardModel_HistogramFamilyIsAggregated(t *testing.T) {
+	model := newDashboardModel(nil, []string{"request_duration_seconds"}, nil, time.Second, 80, 24)
+	get := map[string]string{"method": "get"}
+	post := map[string]string{"method": "post"}
+
+	scrapes := [][]fetcher.MetricData{
+		{histogramMetric(get, 0, 0, 0), histogramMetric(post, 0, 0, 0)},
+		// 10 fast gets and 10 slow posts, without a +Inf bucket as in protobuf
+		{histogramMetric(get, 10, 10), histogramMetric(post, 0, 10)},
+	}
+	for _, data := range scrapes {
+		for i := range data {
+			count := data[i].Buckets[len(data[i].Buckets)-1].CumulativeCount
+			data[i].SampleCount = &count
+		}
+		updated, _ := model.Update(metricsMsg{data: data})
+		model = updated.(dashboardModel)
+	}
+
+	graph := model.graphs["request_duration_seconds"]
+	if len(graph.lines) != len(histogramQuantiles) {
+		t.Fatalf("expected one line per quantile, got %d", len(graph.lines))
+	}
+	// Half of the 20 observations are under 0.1, so p50 is the top of that bucket
+	if p50, _ := graph.lines[0].buffer.Latest(); math.Abs(p50-0.1) > 1e-9 {
+		t.Errorf("expected p50 0.1, got %f", p50)
+	}
+}
+
+// summaryMetric builds a summary with p50 and p99 quantiles
+func summaryMetric(labels map[string]string, p50, p99, sum float64, count uint64) fetcher.MetricData {
+	s := fetcher.NullableFloat64(sum)
+	return fetcher.MetricData{
+		Name:        "rpc_duration_seconds",
+		Type:        "SUMMARY",
+		Labels:      labels,
+		SampleCount: &count,
+		SampleSum:   &s,
+		Quantiles: []fetcher.SummaryQuantile{
+			{Quantile: 0.5, Value: fetcher.NullableFloat64(p50)},
+			{Quantile: 0.99, Value: fetcher.NullableFloat64(p99)},
+		},
+	}
+}
+
+func TestDashboardModel_SummaryQuantiles(t *testing.T) {
+	model := newDashboardModel([]string{"rpc_duration_seconds"}, nil, nil, time.Second, 80, 24)
+
+	scrapes := []fetcher.MetricData{
+		summaryMetric(nil, 0.1, 0.5, 10, 100),
+		// 10 observations adding up to 2s since the previous scrape
+		summaryMetric(nil, 0.2, 0.9, 12, 110),
+		// The process restarted and made 4 observations adding up to 2s
+		summaryMetric(nil, math.NaN(), math.NaN(), 2, 4),
+	}
+	for _, metric := range scrapes {
+		updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{metric}})
+		model = updated.(dashboardModel)
+	}
+
+	graph := model.graphs["rpc_duration_seconds"]
+	if graph.buffer.Len() != 0 {
+		t.Errorf("expected the summary's value not to be plotted, got %v", graph.buffer.Values())
+	}
+	var names []string
+	for _, line := range graph.lines {
+		names = append(names, line.name)
+	}
+	if fmt.Sprint(names) != "[p50 p99 avg]" {
+		t.Fatalf("expected lines [p50 p99 avg], got %v", names)
+	}
+	if p99 := graph.lines[1].buffer.Values(); len(p99) != 2 || p99[1] != 0.9 {
+		t.Errorf("expected NaN quantiles to be skipped, got p99 %v", p99)
+	}
+	if avg := graph.lines[2].buffer.Values(); len(avg) != 2 || math.Abs(avg[0]-0.2) > 1e-9 || avg[1] != 0.5 {
+		t.Errorf("expected averages [0.2 0.5], got %v", avg)
+	}
+	if view := model.View(); !containsString(view, "p99: 0.9") {
+		t.Errorf("expected the legend to show p99, got:\n%s", view)
+	}
+}
+
+func TestMetricGraph_SummaryFamily(t *testing.T) {
+	model := newDashboardModel(nil, []string{"rpc_duration_seconds"}, nil, time.Second, 80, 24)
+	updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{
+		summaryMetric(map[string]string{"method": "get"}, 0.1, 0.5, 10, 100),
+		summaryMetric(map[string]string{"method": "post"}, 0.2, 0.6, 10, 100),
+	}})
+	model = updated.(dashboardModel)
+
+	graph := model.graphs["rpc_duration_seconds"]
+	if graph.line(`{method="get"} p50`) == nil || graph.line(`{method="post"} p99`) == nil {
+		t.Errorf("expected quantile lines per series, got %d lines", len(graph.lines))
+	}
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NimbleMarkets/ntcharts/heatmap"
+	"github.com/NimbleMarkets/ntcharts/linechart"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mcpherrinm/hrmm/internal/buffer"
+)
+
+// heatmapColors is the color scale of heatmap cells, from no observations
+// to the most observations in any cell
+var heatmapColors = []lipgloss.Color{
+	lipgloss.Color("#000000"),
+	lipgloss.Color("#440154"),
+	lipgloss.Color("#482878"),
+	lipgloss.Color("#3E4A89"),
+	lipgloss.Color("#31688E"),
+	lipgloss.Color("#26828E"),
+	lipgloss.Color("#1F9E89"),
+	lipgloss.Color("#35B779"),
+	lipgloss.Color("#6DCD59"),
+	lipgloss.Color("#B4DE2C"),
+	lipgloss.Color("#FDE725"),
+}
+
+// heatmapColumn is the number of observations per bucket during one scrape interval
+type heatmapColumn struct {
+	time   time.Time
+	counts []float64 // parallel to the heatmap's bounds
+}
+
+// histogramHeatmap holds the data of a heatmap panel: time on the X axis,
+// bucket ranges on the Y axis, and observations per bucket per scrape as color
+type histogramHeatmap struct {
+	bounds  []float64 // bucket upper bounds, ascending
+	columns []heatmapColumn
+}
+
+// newHistogramHeatmap builds a heatmap from the deltas of the histograms of
+// a graph. Deltas of different series scraped at the same time are added up.
+func newHistogramHeatmap(histograms map[string]*buffer.HistogramBuffer) histogramHeatmap {
+	byTime := make(map[time.Time][][]buffer.Bucket)
+	var all [][]buffer.Bucket
+	for _, hb := range histograms {
+		for _, delta := range hb.Deltas() {
+			byTime[delta.Time] = append(byTime[delta.Time], delta.Buckets)
+			all = append(all, delta.Buckets)
+		}
+	}
+
+	var hm histogramHeatmap
+	for _, b := range buffer.MergeBuckets(all...) {
+		hm.bounds = append(hm.bounds, b.UpperBound)
+	}
+	for t, deltas := range byTime {
+		hm.columns = append(hm.columns, heatmapColumn{
+			time:   t,
+			counts: bucketCounts(hm.bounds, buffer.MergeBuckets(deltas...)),
+		})
+	}
+	sort.Slice(hm.columns, func(i, j int) bool { return hm.columns[i].time.Before(hm.columns[j].time) })
+	return hm
+}
+
+// bucketCounts converts cumulative buckets into the number of observations
+// in each bucket, for each of bounds. Bounds missing from buckets are empty.
+func bucketCounts(bounds []float64, buckets []buffer.Bucket) []float64 {
+	cumulative := make(map[float64]float64, len(buckets))
+	for _, b := range buckets {
+		cumulative[b.UpperBound] = b.Count
+	}
+	counts := make([]float64, len(bounds))
+	prev := 0.0
+	for i, bound := range bounds {
+		c, ok := cumulative[bound]
+		if !ok {
+			continue
+		}
+		counts[i] = max(c-prev, 0)
+		prev = c
+	}
+	return counts
+}
+
+// cellRange returns the range [lo, hi) of n items shown in cell i of cells.
+// Items are spread over cells when there are fewer items than cells.
+func cellRange(i, cells, n int) (lo, hi int) {
+	lo = i * n / cells
+	hi = (i + 1) * n / cells
+	if hi <= lo {
+		hi = lo + 1
+	}
+	return lo, hi
+}
+
+// formatBound formats a bucket upper bound as a Y axis label
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", bound)
+}
+
+// Render draws the heatmap in a w by h cell area, including axes. The most
+// recent scrapes are shown when there are more than fit the width. Colors
+// use a log scale, so that rare observations in the tail remain visible.
+func (hm histogramHeatmap) Render(w, h int) string {
+	if len(hm.columns) == 0 {
+		return lipgloss.NewStyle().Width(w).Height(h).Render("(waiting for a second scrape)")
+	}
+
+	rows := h - 2 // the X axis and its labels take two rows
+	yLabel := func(i int, _ float64) string {
+		if i == 0 {
+			return "0"
+		}
+		// Label only the top row of the rows showing the same buckets
+		_, hi := cellRange(i-1, rows, len(hm.bounds))
+		if _, next := cellRange(i, rows, len(hm.bounds)); i < rows && next == hi {
+			return ""
+		}
+		return formatBound(hm.bounds[hi-1])
+	}
+	lc := linechart.New(w, h, 0, float64(w), 0, float64(rows),
+		linechart.WithXYSteps(2, 1),
+		linechart.WithYLabelFormatter(yLabel),
+	)
+	lc.SetViewXRange(0, float64(lc.GraphWidth()))
+
+	cols := lc.GraphWidth()
+	columns := hm.columns
+	if len(columns) > cols {
+		columns = columns[len(columns)-cols:]
+	}
+	lc.XLabelFormatter = func(i int, _ float64) string {
+		lo, _ := cellRange(min(i, cols-1), cols, len(columns))
+		return columns[lo].time.Format("15:04:05")
+	}
+
+	// Each cell adds up the buckets of its rows and the scrapes of its columns
+	cells := make([][]float64, cols)
+	maxCount := 0.0
+	for x := range cells {
+		cells[x] = make([]float64, rows)
+		lo, hi := cellRange(x, cols, len(columns))
+		for _, column := range columns[lo:min(hi, len(columns))] {
+			for y := range cells[x] {
+				bLo, bHi := cellRange(y, rows, len(hm.bounds))
+				for _, c := range column.counts[bLo:min(bHi, len(hm.bounds))] {
+					cells[x][y] += c
+				}
+			}
+		}
+		for _, c := range cells[x] {
+			maxCount = max(maxCount, c)
+		}
+	}
+
+	hmModel := heatmap.New(w, h,
+		heatmap.WithStyle(lc),
+		heatmap.WithColorScale(heatmapColors),
+		heatmap.WithValueRange(0, math.Log1p(max(maxCount, 1))),
+	)
+	hmModel.DrawXYAxisAndLabel()
+	for x, column := range cells {
+		for y, c := range column {
+			// Points sit in the middle of their cell
+			hmModel.Push(heatmap.NewHeatPoint(float64(x)+0.5, float64(y)+0.5, math.Log1p(c)))
+		}
+	}
+	hmModel.Draw()
+	return hmModel.View()
+}
+
+// heatmapLegend describes the color scale of a heatmap
+func heatmapLegend(hm histogramHeatmap) string {
+	maxCount := 0.0
+	for _, column := range hm.columns {
+		for _, c := range column.counts {
+			maxCount = max(maxCount, c)
+		}
+	}
+	var scale strings.Builder
+	for _, color := range heatmapColors {
+		scale.WriteString(lipgloss.NewStyle().Background(color).Render(" "))
+	}
+	return fmt.Sprintf("observations per scrape: 0 %s %g", scale.String(), maxCount)
+}
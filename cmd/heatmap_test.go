@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mcpherrinm/hrmm/internal/buffer"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+	"github.com/muesli/termenv"
+)
+
+func TestNewHistogramHeatmap(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bounds := []float64{0.1, 1, math.Inf(1)}
+	cumulative := func(counts ...float64) []buffer.Bucket {
+		var b []buffer.Bucket
+		for i, c := range counts {
+			b = append(b, buffer.Bucket{UpperBound: bounds[i], Count: c})
+		}
+		return b
+	}
+
+	get := buffer.NewHistogram(10)
+	post := buffer.NewHistogram(10)
+	for i, counts := range [][]float64{{0, 0, 0}, {5, 5, 5}, {5, 15, 17}} {
+		at := start.Add(time.Duration(i) * time.Second)
+		get.Push(at, cumulative(counts...))
+		post.Push(at, cumulative(counts...))
+	}
+
+	hm := newHistogramHeatmap(map[string]*buffer.HistogramBuffer{"get": get, "post": post})
+	if len(hm.bounds) != 3 {
+		t.Fatalf("expected 3 bounds, got %v", hm.bounds)
+	}
+	if len(hm.columns) != 2 {
+		t.Fatalf("expected series scraped together to share a column, got %d columns", len(hm.columns))
+	}
+	// Per-bucket observations, not cumulative, added up over both series
+	expected := [][]float64{{10, 0, 0}, {0, 20, 4}}
+	for i, column := range hm.columns {
+		for j, c := range column.counts {
+			if c != expected[i][j] {
+				t.Errorf("column %d: expected %v, got %v", i, expected[i], column.counts)
+				break
+			}
+		}
+	}
+}
+
+func TestCellRange(t *testing.T) {
+	// Fewer items than cells are stretched over several cells
+	for i, expected := range []int{0, 0, 1, 1} {
+		if lo, hi := cellRange(i, 4, 2); lo != expected || hi != expected+1 {
+			t.Errorf("cell %d: expected [%d,%d), got [%d,%d)", i, expected, expected+1, lo, hi)
+		}
+	}
+	// More items than cells are grouped
+	if lo, hi := cellRange(1, 2, 6); lo != 3 || hi != 6 {
+		t.Errorf("expected [3,6), got [%d,%d)", lo, hi)
+	}
+}
+
+func TestHistogramHeatmap_Render(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+
+	hm := histogramHeatmap{
+		bounds: []float64{0.1, 1, math.Inf(1)},
+		columns: []heatmapColumn{
+			{time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local), counts: []float64{10, 0, 0}},
+			{time: time.Date(2024, 1, 1, 12, 0, 1, 0, time.Local), counts: []float64{0, 0, 10}},
+		},
+	}
+	view := hm.Render(40, 8)
+	if lines := strings.Split(view, "\n"); len(lines) != 8 {
+		t.Errorf("expected 8 lines, got %d", len(lines))
+	}
+	for _, label := range []string{"+Inf", "0.1", "12:00:00", "12:00:01"} {
+		if !strings.Contains(view, label) {
+			t.Errorf("expected label %q in heatmap:\n%s", label, view)
+		}
+	}
+	// The busiest cells get the brightest color, as a background
+	if !strings.Contains(view, "48;2;253;231;3") {
+		t.Errorf("expected the top of the color scale in heatmap:\n%q", view)
+	}
+
+	empty := histogramHeatmap{}
+	if view := empty.Render(40, 8); !strings.Contains(view, "waiting") {
+		t.Errorf("expected a placeholder without data, got %q", view)
+	}
+}
+
+func TestDashboardModel_HeatmapColumnsOverScrapes(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+
+	model := newDashboardModel([]string{"request_duration_seconds"}, nil, nil, 10*time.Second, 80, 24)
+	// 10 observations in (0.1,1] between each of the scrapes, 10s apart
+	start := time.Now()
+	for i := range 5 {
+		count := uint64(10 * i)
+		msg := metricsMsg{
+			data: []fetcher.MetricData{histogramMetric(nil, 0, count, count)},
+			time: start.Add(time.Duration(i) * 10 * time.Second),
+		}
+		updated, _ := model.Update(msg)
+		model = updated.(dashboardModel)
+	}
+
+	// Every column holds a whole interval's observations
+	hm := newHistogramHeatmap(model.graphs["request_duration_seconds"].histograms)
+	if len(hm.columns) != 4 {
+		t.Fatalf("expected a column per scrape after the first, got %d", len(hm.columns))
+	}
+	for i, column := range hm.columns {
+		if fmt.Sprint(column.counts) != "[0 10 0]" {
+			t.Errorf("column %d: expected [0 10 0], got %v", i, column.counts)
+		}
+	}
+
+	// so every cell of the busy bucket is drawn in the same color, and the
+	// rest are empty
+	view := hm.Render(40, 8)
+	colors := make(map[string]bool)
+	for _, code := range regexp.MustCompile(`48;2;\d+;\d+;\d+`).FindAllString(view, -1) {
+		colors[code] = true
+	}
+	if len(colors) != 2 || !colors["48;2;0;0;0"] {
+		t.Errorf("expected only empty and full cells, got colors %v in:\n%q", colors, view)
+	}
+}
+
+func TestDashboardModel_HeatmapToggle(t *testing.T) {
+	model := newDashboardModel([]string{"request_duration_seconds"}, nil, nil, time.Second, 80, 24)
+	for _, counts := range [][]uint64{{10, 10, 10}, {10, 20, 20}} {
+		updated, _ := model.Update(metricsMsg{data: []fetcher.MetricData{histogramMetric(nil, counts...)}})
+		model = updated.(dashboardModel)
+	}
+
+	if strings.Contains(model.View(), "observations per scrape") {
+		t.Error("expected quantile lines before toggling heatmaps")
+	}
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}})
+	model = updated.(dashboardModel)
+	if !model.heatmaps {
+		t.Fatal("expected h to toggle heatmaps")
+	}
+	if !strings.Contains(model.View(), "observations per scrape") {
+		t.Error("expected the histogram to be shown as a heatmap")
+	}
+}
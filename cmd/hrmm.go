@@ -1,18 +1,29 @@
 package cmd
 
 import (
-	"fmt"
+	"strings"
 	"time"
 
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
 	"github.com/spf13/cobra"
 )
 
 var (
 	urls         []string
 	metrics      []string
+	excludes     []string
 	labels       []string
 	jsonOutput   bool
+	outputFormat string
+	templateText string
+	watchOutput  bool
 	pollInterval time.Duration
+	timeout      time.Duration
+	listenAddr   string
+	bufferSize   int
+	clientFlags  targetConfig
+	targetsFile  string
+	limits       fetcher.Limits
 )
 
 var RootCmd = &cobra.Command{
@@ -21,26 +32,99 @@ var RootCmd = &cobra.Command{
 	Long:  "hrmm is a tool for watching a system's live state by polling prometheus metrics endpoints.",
 }
 
-var serveCmd = &cobra.Command{
-	Use:   "serve",
-	Short: "Run as a webserver polling and streaming metrics",
-	Long:  "Run as a webserver, polling prometheus endpoints and streaming results to clients. Results are stored in memory in a rolling buffer.",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Serve command called with URLs: %v, Metrics: %v\n", urls, metrics)
-		// TODO: Implement serve functionality
-	},
-}
-
 func init() {
-	RootCmd.PersistentFlags().StringSliceVarP(&urls, "url", "u", []string{}, "URL of a prometheus metrics endpoint (required, can be repeated)")
-	RootCmd.PersistentFlags().StringSliceVarP(&metrics, "metric", "m", []string{}, "Select this prometheus metric name")
-	RootCmd.PersistentFlags().StringSliceVarP(&labels, "label", "l", []string{}, "Select this Prometheus metric label")
+	RootCmd.PersistentFlags().StringSliceVarP(&urls, "url", "u", []string{}, "URL of a prometheus metrics endpoint (can be repeated)")
+	RootCmd.PersistentFlags().StringArrayVarP(&metrics, "metric", "m", []string{}, "Select this metric name, name pattern like go_gc_.* or process_*, or series selector like name{code=~\"5..\"} (can be repeated or comma separated)")
+	RootCmd.PersistentFlags().StringArrayVar(&excludes, "exclude-metric", []string{}, "Leave out metrics matching this name, pattern or selector (can be repeated or comma separated)")
+	RootCmd.PersistentFlags().StringArrayVarP(&labels, "label", "l", []string{}, "Only select series matching all of these label matchers: name, name=value, name!=value, name=~regex or name!~regex, with values containing commas quoted (can be repeated or comma separated)")
 	RootCmd.PersistentFlags().DurationVarP(&pollInterval, "interval", "i", 10*time.Second, "Poll interval for metrics collection (e.g., 10s, 1m, 500ms)")
-	RootCmd.MarkPersistentFlagRequired("url")
+	RootCmd.PersistentFlags().DurationVar(&timeout, "scrape-timeout", 0, "Timeout for each scrape (default the poll interval)")
+	RootCmd.PersistentFlags().Int64Var(&limits.BodySize, "body-size-limit", 0, "Fail scrapes whose body is larger than this many bytes (0 for no limit)")
+	RootCmd.PersistentFlags().IntVar(&limits.Samples, "sample-limit", 0, "Fail scrapes with more than this many samples left after filtering (0 for no limit)")
+	RootCmd.PersistentFlags().StringVar(&clientFlags.BearerTokenFile, "bearer-token-file", "", "Send the bearer token in this file to targets")
+	RootCmd.PersistentFlags().StringVar(&clientFlags.BasicAuth, "basic-auth", "", "Authenticate to targets with basic auth, as user:passfile")
+	RootCmd.PersistentFlags().StringVar(&clientFlags.CAFile, "ca-file", "", "Verify targets with the CA certificates in this file")
+	RootCmd.PersistentFlags().StringVar(&clientFlags.CertFile, "cert-file", "", "Client certificate file for mutual TLS")
+	RootCmd.PersistentFlags().StringVar(&clientFlags.KeyFile, "key-file", "", "Client key file for mutual TLS")
+	RootCmd.PersistentFlags().BoolVar(&clientFlags.InsecureSkipVerify, "insecure-skip-verify", false, "Don't verify the TLS certificates of targets")
+	RootCmd.PersistentFlags().StringArrayVar(&clientFlags.Headers, "header", nil, "Send this \"Name: value\" header to targets (can be repeated)")
+	RootCmd.PersistentFlags().StringVar(&targetsFile, "targets-file", "", "JSON file listing targets, each with its url and its own auth, TLS and header settings")
+
+	printCmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output in JSON format, the same as --format json")
+	printCmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, openmetrics, csv, tsv or influx")
+	printCmd.Flags().StringVar(&templateText, "template", "", "Print with this Go template, executed with the []fetcher.MetricData of every target")
+	printCmd.Flags().BoolVarP(&watchOutput, "watch", "w", false, "Keep scraping every --interval, redrawing a table of the values or printing NDJSON with --json")
 
-	printCmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output in JSON format")
+	diffCmd.Flags().DurationVar(&diffAfter, "after", 0, "Compare one target with itself this long after the first scrape, such as 30s")
+	diffCmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output in JSON format")
+
+	serveCmd.Flags().StringVarP(&listenAddr, "listen", "a", ":8080", "Address for the HTTP server to listen on")
+	serveCmd.Flags().IntVarP(&bufferSize, "buffer-size", "b", 300, "Number of samples to keep in memory for each series")
 
 	RootCmd.AddCommand(graphCmd)
 	RootCmd.AddCommand(serveCmd)
 	RootCmd.AddCommand(printCmd)
+	RootCmd.AddCommand(diffCmd)
+}
+
+// scrapeTimeout returns the per-scrape timeout: --scrape-timeout if set,
+// otherwise the poll interval, so that a hung target can't delay the next poll
+func scrapeTimeout() time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return pollInterval
+}
+
+// metricFilter parses --metric, --exclude-metric and --label into the
+// filter every fetcher shares
+func metricFilter() (*fetcher.Filter, error) {
+	var selectors, exclude, matchers []string
+	for _, m := range metrics {
+		selectors = append(selectors, splitSelectors(m)...)
+	}
+	for _, m := range excludes {
+		exclude = append(exclude, splitSelectors(m)...)
+	}
+	for _, l := range labels {
+		matchers = append(matchers, splitSelectors(l)...)
+	}
+	return fetcher.ParseFilter(selectors, exclude, matchers)
+}
+
+// splitSelectors splits a comma separated list of selectors, ignoring the
+// commas between the label matchers of a selector
+func splitSelectors(s string) []string {
+	var selectors []string
+	add := func(selector string) {
+		if selector = strings.TrimSpace(selector); selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+	depth, start := 0, 0
+	var quote rune
+	escaped := false
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			add(s[start:i])
+			start = i + 1
+		}
+	}
+	add(s[start:])
+	return selectors
 }
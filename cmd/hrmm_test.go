@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitSelectors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"up", []string{"up"}},
+		{"up, go_goroutines,", []string{"up", "go_goroutines"}},
+		{`http_requests_total{code=~"5..",method!="GET"},up`, []string{`http_requests_total{code=~"5..",method!="GET"}`, "up"}},
+		{`x{a="},{\"",b="c"},y`, []string{`x{a="},{\"",b="c"}`, "y"}},
+		{"x{a=`,`}", []string{"x{a=`,`}"}},
+		{"", nil},
+	}
+	for _, tc := range tests {
+		if got := splitSelectors(tc.input); !slices.Equal(got, tc.expected) {
+			t.Errorf("splitSelectors(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestMetricFilter_Labels(t *testing.T) {
+	defer func() { labels = nil }()
+
+	// Quoted values may contain commas, and flags can be comma separated
+	labels = []string{`code="500"`, `path=~"/a,/b",method`}
+	filter, err := metricFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.Matchers) != 3 {
+		t.Fatalf("expected 3 matchers, got %v", filter.Matchers)
+	}
+	if !filter.Matches("x", map[string]string{"code": "500", "path": "/a,/b", "method": "GET"}) {
+		t.Error("expected the matchers to select the series")
+	}
+	if filter.Matches("x", map[string]string{"code": "500", "path": "/a", "method": "GET"}) {
+		t.Error("expected the regex to match the whole value")
+	}
+}
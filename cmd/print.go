@@ -1,11 +1,14 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"sort"
-	"strings"
+	"io"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/x/term"
 
 	"github.com/mcpherrinm/hrmm/internal/fetcher"
 	"github.com/spf13/cobra"
@@ -14,74 +17,153 @@ import (
 var printCmd = &cobra.Command{
 	Use:   "print",
 	Short: "Fetch and print the specified URL and metric values",
-	Long:  "Fetch prometheus metrics from the specified URLs and print the metric values. Use --json flag for JSON output.",
+	Long: "Fetch prometheus metrics from the specified URLs and print the metric values. " +
+		"Use --format for JSON, OpenMetrics, CSV, TSV or InfluxDB line protocol output instead of the prometheus text format, " +
+		"--template prints with a Go template instead, and --watch keeps scraping every --interval.",
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, url := range urls {
-			metricsFetcher := fetcher.New(url, metrics, labels)
-			metricsData, err := metricsFetcher.Fetch()
+		// Errors go to stderr, to keep the output parseable
+		format, err := printFormat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fetchers, err := newFetchers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring targets: %v\n", err)
+			os.Exit(1)
+		}
+		if watchOutput {
+			if err := printWatch(cmd.Context(), fetchers, format); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if format == "json" {
+			fetched, err := printJSON(cmd.Context(), fetchers)
 			if err != nil {
-				fmt.Printf("Error fetching metrics from %s: %v\n", url, err)
-				continue
+				fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+				os.Exit(1)
 			}
+			if !fetched {
+				os.Exit(1)
+			}
+			return
+		}
 
-			if jsonOutput {
-				jsonData, err := json.MarshalIndent(metricsData, "", "  ")
-				if err != nil {
-					fmt.Printf("Error marshaling JSON: %v\n", err)
-					continue
-				}
-				fmt.Println(string(jsonData))
-			} else {
-				// Output in Prometheus text format with HELP and TYPE comments
-				printPrometheusFormat(metricsData)
+		encoder, err := newEncoder(os.Stdout, format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		// Every target is encoded together, so that CSV output has one header.
+		// The targets that were fetched are printed even if others failed.
+		t := time.Now()
+		fetched := true
+		var metricsData []fetcher.MetricData
+		for _, metricsFetcher := range fetchers {
+			data, err := metricsFetcher.FetchContext(cmd.Context())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching metrics from %s: %v\n", metricsFetcher.URL(), err)
+				fetched = false
+				continue
 			}
+			metricsData = append(metricsData, data...)
+		}
+		if err := encoder.Encode(t, metricsData); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", err)
+			os.Exit(1)
+		}
+		if !fetched {
+			os.Exit(1)
 		}
 	},
 }
 
-// printPrometheusFormat outputs metrics in Prometheus exposition format with HELP and TYPE comments
-func printPrometheusFormat(metricsData []fetcher.MetricData) {
-	// Group metrics by name to output HELP and TYPE comments only once per metric family
-	metricGroups := make(map[string][]fetcher.MetricData)
-	metricMeta := make(map[string]fetcher.MetricData) // Store help and type info
-
-	for _, metric := range metricsData {
-		metricGroups[metric.Name] = append(metricGroups[metric.Name], metric)
-		if _, exists := metricMeta[metric.Name]; !exists {
-			metricMeta[metric.Name] = metric
+// printFormat returns the --format to print, which --json is a shorthand
+// for, or "template" for --template
+func printFormat() (string, error) {
+	if templateText != "" {
+		if jsonOutput || outputFormat != "text" {
+			return "", fmt.Errorf("--template can't be used with --json or --format")
 		}
+		return "template", nil
+	}
+	if !jsonOutput {
+		return outputFormat, nil
 	}
+	if outputFormat != "text" && outputFormat != "json" {
+		return "", fmt.Errorf("--json can't be used with --format %s", outputFormat)
+	}
+	return "json", nil
+}
 
-	// Sort metric names for consistent output
-	var metricNames []string
-	for name := range metricGroups {
-		metricNames = append(metricNames, name)
+// newEncoder returns the encoder of a print format other than json
+func newEncoder(w io.Writer, format string) (fetcher.Encoder, error) {
+	if format == "template" {
+		return newTemplateEncoder(w, templateText)
 	}
-	sort.Strings(metricNames)
+	return fetcher.NewEncoder(w, format)
+}
 
-	// Output each metric family
-	for i, name := range metricNames {
-		if i > 0 {
-			fmt.Println() // Add blank line between metric families
+// printJSON prints the metrics of each target as a JSON array, and reports
+// whether every target was fetched
+func printJSON(ctx context.Context, fetchers []*fetcher.MetricsFetcher) (bool, error) {
+	fetched := true
+	for _, metricsFetcher := range fetchers {
+		metricsData, err := metricsFetcher.FetchContext(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching metrics from %s: %v\n", metricsFetcher.URL(), err)
+			fetched = false
+			continue
 		}
-
-		meta := metricMeta[name]
-
-		// Output HELP comment if available
-		if meta.Help != "" {
-			fmt.Printf("# HELP %s %s\n", name, meta.Help)
+		jsonData, err := json.MarshalIndent(metricsData, "", "  ")
+		if err != nil {
+			return fetched, err
 		}
+		fmt.Println(string(jsonData))
+	}
+	return fetched, nil
+}
 
-		// Output TYPE comment if available
-		if meta.Type != "" {
-			fmt.Printf("# TYPE %s %s\n", name, strings.ToLower(meta.Type))
-		}
+// printWatch prints every --interval until interrupted: NDJSON for json, a
+// table redrawn in place when printing text to a terminal, and otherwise
+// each round of scrapes in the format
+func printWatch(ctx context.Context, fetchers []*fetcher.MetricsFetcher, format string) error {
+	switch format {
+	case "json":
+		return watch(ctx, fetchers, pollInterval, func(t time.Time, scrapes []targetScrape) error {
+			return writeWatchJSON(os.Stdout, t, scrapes)
+		})
+	case "text":
+		table := newWatchTable(pollInterval)
+		redraw := term.IsTerminal(os.Stdout.Fd())
+		return watch(ctx, fetchers, pollInterval, func(t time.Time, scrapes []targetScrape) error {
+			output := table.render(t, scrapes)
+			if redraw {
+				// Move to the top left and clear the screen, like watch(1)
+				output = "\x1b[H\x1b[2J" + output
+			} else {
+				output += "\n"
+			}
+			_, err := io.WriteString(os.Stdout, output)
+			return err
+		})
+	}
 
-		// Output all metrics in this family
-		for _, metric := range metricGroups[name] {
-			var buf bytes.Buffer
-			metric.Print(&buf)
-			fmt.Print(buf.String())
-		}
+	encoder, err := newEncoder(os.Stdout, format)
+	if err != nil {
+		return err
 	}
+	return watch(ctx, fetchers, pollInterval, func(t time.Time, scrapes []targetScrape) error {
+		var metricsData []fetcher.MetricData
+		for _, scrape := range scrapes {
+			if scrape.err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching metrics from %s: %v\n", scrape.url, scrape.err)
+				continue
+			}
+			metricsData = append(metricsData, scrape.data...)
+		}
+		return encoder.Encode(t, metricsData)
+	})
 }
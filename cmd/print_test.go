@@ -0,0 +1,33 @@
+package cmd
+
+import "testing"
+
+func TestPrintFormat(t *testing.T) {
+	defer func() { jsonOutput, outputFormat, templateText = false, "text", "" }()
+
+	tests := []struct {
+		json     bool
+		format   string
+		template string
+		expected string // format, or empty for an error
+	}{
+		{false, "text", "", "text"},
+		{false, "csv", "", "csv"},
+		{true, "text", "", "json"},
+		{true, "json", "", "json"},
+		{true, "csv", "", ""},
+		{false, "text", "{{len .}}", "template"},
+		{true, "text", "{{len .}}", ""},
+		{false, "csv", "{{len .}}", ""},
+	}
+	for _, tc := range tests {
+		jsonOutput, outputFormat, templateText = tc.json, tc.format, tc.template
+		format, err := printFormat()
+		switch {
+		case tc.expected == "" && err == nil:
+			t.Errorf("--json=%v --format %s: expected an error, got %s", tc.json, tc.format, format)
+		case tc.expected != "" && (err != nil || format != tc.expected):
+			t.Errorf("--json=%v --format %s: expected %s, got %s, %v", tc.json, tc.format, tc.expected, format, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mcpherrinm/hrmm/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as a webserver polling and streaming metrics",
+	Long:  "Run as a webserver, polling prometheus endpoints and streaming results to clients. Results are stored in memory in a rolling buffer.",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		// The buffers need room for at least one sample
+		if bufferSize < 1 {
+			return fmt.Errorf("invalid --buffer-size %d: must be at least 1", bufferSize)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fetchers, err := newFetchers()
+		if err != nil {
+			fmt.Printf("Error configuring targets: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		srv := server.New(fetchers, pollInterval, bufferSize)
+		go srv.Run(ctx)
+
+		httpServer := &http.Server{
+			Addr:    listenAddr,
+			Handler: srv.Handler(),
+		}
+		go func() {
+			<-ctx.Done()
+			httpServer.Shutdown(context.Background())
+		}()
+
+		fmt.Printf("Serving on %s\n", listenAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error running server: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import "testing"
+
+func TestServeBufferSize(t *testing.T) {
+	defer func(size int) { bufferSize = size }(bufferSize)
+
+	for size, valid := range map[int]bool{-1: false, 0: false, 1: true, 300: true} {
+		bufferSize = size
+		if err := serveCmd.PreRunE(serveCmd, nil); (err == nil) != valid {
+			t.Errorf("--buffer-size %d: expected valid %v, got %v", size, valid, err)
+		}
+	}
+}
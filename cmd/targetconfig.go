@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// targetConfig is how to scrape one target. Flags set it for every --url,
+// and entries of --targets-file override the flags for their own target.
+// Fields mirror the flags.
+type targetConfig struct {
+	URL                string   `json:"url"`
+	BearerTokenFile    string   `json:"bearer_token_file,omitempty"`
+	BasicAuth          string   `json:"basic_auth,omitempty"` // user:passfile
+	CAFile             string   `json:"ca_file,omitempty"`
+	CertFile           string   `json:"cert_file,omitempty"`
+	KeyFile            string   `json:"key_file,omitempty"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+	Headers            []string `json:"headers,omitempty"` // "Name: value"
+}
+
+// clientConfig converts the flag syntax of a target's settings
+func (tc targetConfig) clientConfig() (fetcher.ClientConfig, error) {
+	cfg := fetcher.ClientConfig{
+		BearerTokenFile:    tc.BearerTokenFile,
+		CAFile:             tc.CAFile,
+		CertFile:           tc.CertFile,
+		KeyFile:            tc.KeyFile,
+		InsecureSkipVerify: tc.InsecureSkipVerify,
+	}
+	if tc.BasicAuth != "" {
+		user, passwordFile, ok := strings.Cut(tc.BasicAuth, ":")
+		if !ok || user == "" {
+			return cfg, fmt.Errorf("basic auth %q must be user:passfile", tc.BasicAuth)
+		}
+		cfg.BasicAuthUser = user
+		cfg.BasicAuthPasswordFile = passwordFile
+	}
+	for _, header := range tc.Headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return cfg, fmt.Errorf("header %q must be \"Name: value\"", header)
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = make(map[string]string)
+		}
+		cfg.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return cfg, nil
+}
+
+// loadTargets returns the configuration of every --url, followed by the
+// targets in --targets-file
+func loadTargets() ([]targetConfig, error) {
+	var targets []targetConfig
+	for _, url := range urls {
+		tc := clientFlags
+		tc.URL = url
+		targets = append(targets, tc)
+	}
+
+	if targetsFile != "" {
+		data, err := os.ReadFile(targetsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read targets file: %w", err)
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse targets file %s: %w", targetsFile, err)
+		}
+		for i, entry := range entries {
+			// Decoding over the flags keeps them for fields the entry doesn't set
+			tc := clientFlags
+			tc.URL = ""
+			if err := json.Unmarshal(entry, &tc); err != nil {
+				return nil, fmt.Errorf("failed to parse target %d in %s: %w", i, targetsFile, err)
+			}
+			if tc.URL == "" {
+				return nil, fmt.Errorf("target %d in %s has no url", i, targetsFile)
+			}
+			targets = append(targets, tc)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required, with --url or --targets-file")
+	}
+	return targets, nil
+}
+
+// newFetchers creates a fetcher for every target, with the options shared by every command
+func newFetchers() ([]*fetcher.MetricsFetcher, error) {
+	targets, err := loadTargets()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := metricFilter()
+	if err != nil {
+		return nil, err
+	}
+	var fetchers []*fetcher.MetricsFetcher
+	for _, tc := range targets {
+		f := fetcher.New(tc.URL, filter)
+		f.SetTimeout(scrapeTimeout())
+		f.SetLimits(limits)
+		cfg, err := tc.clientConfig()
+		if err == nil {
+			err = f.Configure(cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", tc.URL, err)
+		}
+		fetchers = append(fetchers, f)
+	}
+	return fetchers, nil
+}
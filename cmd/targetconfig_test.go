@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTargets(t *testing.T) {
+	defer func(u []string, flags targetConfig, file string) {
+		urls, clientFlags, targetsFile = u, flags, file
+	}(urls, clientFlags, targetsFile)
+
+	targetsFile = filepath.Join(t.TempDir(), "targets.json")
+	err := os.WriteFile(targetsFile, []byte(`[
+		{"url": "https://a.internal/metrics", "bearer_token_file": "/etc/hrmm/a.token"},
+		{"url": "https://b.internal/metrics", "headers": ["X-Scope-OrgID: b"]}
+	]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls = []string{"http://localhost:9100/metrics"}
+	clientFlags = targetConfig{CAFile: "/etc/hrmm/ca.pem", Headers: []string{"X-Scope-OrgID: default"}}
+
+	targets, err := loadTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("expected 3 targets, got %d", len(targets))
+	}
+	if targets[0].URL != "http://localhost:9100/metrics" || targets[0].CAFile != "/etc/hrmm/ca.pem" {
+		t.Errorf("expected --url to use the flags, got %+v", targets[0])
+	}
+	// File entries override the flags they set and keep the others
+	if targets[1].BearerTokenFile != "/etc/hrmm/a.token" || targets[1].CAFile != "/etc/hrmm/ca.pem" {
+		t.Errorf("expected the token file along with the flags' CA, got %+v", targets[1])
+	}
+	if len(targets[2].Headers) != 1 || targets[2].Headers[0] != "X-Scope-OrgID: b" {
+		t.Errorf("expected the entry's headers to replace the flags', got %v", targets[2].Headers)
+	}
+
+	urls, targetsFile = nil, ""
+	if _, err := loadTargets(); err == nil {
+		t.Error("expected an error without targets")
+	}
+}
+
+func TestTargetConfig_ClientConfig(t *testing.T) {
+	cfg, err := targetConfig{
+		BasicAuth: "prometheus:/etc/hrmm/password",
+		Headers:   []string{"X-Scope-OrgID: team-a", "Host:exporter.internal"},
+	}.clientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BasicAuthUser != "prometheus" || cfg.BasicAuthPasswordFile != "/etc/hrmm/password" {
+		t.Errorf("unexpected basic auth %q %q", cfg.BasicAuthUser, cfg.BasicAuthPasswordFile)
+	}
+	if cfg.Headers["X-Scope-OrgID"] != "team-a" || cfg.Headers["Host"] != "exporter.internal" {
+		t.Errorf("unexpected headers %v", cfg.Headers)
+	}
+
+	for _, tc := range []targetConfig{{BasicAuth: "prometheus"}, {Headers: []string{"no colon"}}} {
+		if _, err := tc.clientConfig(); err == nil || !strings.Contains(err.Error(), "must be") {
+			t.Errorf("expected a syntax error for %+v, got %v", tc, err)
+		}
+	}
+}
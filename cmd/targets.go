@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// targetScrape is the outcome of scraping one target
+type targetScrape struct {
+	url      string
+	data     []fetcher.MetricData
+	err      error
+	duration time.Duration
+}
+
+// targetHealth tracks the scrapes of one target, like prometheus' up metric
+type targetHealth struct {
+	up          bool
+	lastError   error
+	lastSuccess time.Time
+	duration    time.Duration // of the most recent scrape
+}
+
+// scrapeTargets scrapes every target in parallel, each within its own
+// scrape timeout, so that one hung target doesn't hold up the others.
+// Results are in the order of fetchers.
+func scrapeTargets(ctx context.Context, fetchers []*fetcher.MetricsFetcher) []targetScrape {
+	scrapes := make([]targetScrape, len(fetchers))
+	var wg sync.WaitGroup
+	for i, f := range fetchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			data, err := f.FetchContext(ctx)
+			scrapes[i] = targetScrape{url: f.URL(), data: data, err: err, duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return scrapes
+}
+
+// newMetricsMsg combines the scrapes of every target. The message only has
+// an error if every target failed, as there is nothing to plot.
+func newMetricsMsg(scrapes []targetScrape) metricsMsg {
+	msg := metricsMsg{targets: scrapes}
+	var errs []error
+	for _, scrape := range scrapes {
+		if scrape.err != nil {
+			errs = append(errs, scrape.err)
+			continue
+		}
+		msg.data = append(msg.data, scrape.data...)
+	}
+	if len(errs) > 0 && len(errs) == len(scrapes) {
+		msg.err = errors.Join(errs...)
+	}
+	return msg
+}
+
+// updateHealth records the outcome of each target's scrape at t
+func updateHealth(health map[string]*targetHealth, scrapes []targetScrape, t time.Time) {
+	for _, scrape := range scrapes {
+		h, ok := health[scrape.url]
+		if !ok {
+			h = &targetHealth{}
+			health[scrape.url] = h
+		}
+		h.up = scrape.err == nil
+		h.lastError = scrape.err
+		h.duration = scrape.duration
+		if h.up {
+			h.lastSuccess = t
+		}
+	}
+}
+
+// renderTargetHealth renders one line per target with its health, sorted by URL
+func renderTargetHealth(health map[string]*targetHealth, now time.Time) string {
+	urls := make([]string, 0, len(health))
+	for url := range health {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	upStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00"))
+	downStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	var lines []string
+	for _, url := range urls {
+		h := health[url]
+		if h.up {
+			lines = append(lines, fmt.Sprintf("%s %s (%s)", upStyle.Render("● up"), url, h.duration.Round(time.Millisecond)))
+			continue
+		}
+		line := fmt.Sprintf("%s %s: %v", downStyle.Render("● down"), url, h.lastError)
+		if h.lastSuccess.IsZero() {
+			line += " | never succeeded"
+		} else {
+			line += fmt.Sprintf(" | last success %s ago", now.Sub(h.lastSuccess).Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+func TestScrapeTargets_Parallel(t *testing.T) {
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "test_metric 1")
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	fetchers := []*fetcher.MetricsFetcher{
+		fetcher.New(hung.URL, nil),
+		fetcher.New(healthy.URL, nil),
+		fetcher.New(broken.URL, nil),
+	}
+	fetchers[0].SetTimeout(100 * time.Millisecond)
+	start := time.Now()
+	scrapes := scrapeTargets(context.Background(), fetchers)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the hung target to time out, took %s", elapsed)
+	}
+
+	if len(scrapes) != 3 {
+		t.Fatalf("expected 3 scrapes, got %d", len(scrapes))
+	}
+	if scrapes[0].err == nil || !strings.Contains(scrapes[0].err.Error(), "timed out") {
+		t.Errorf("expected the hung target to time out, got %v", scrapes[0].err)
+	}
+	if scrapes[1].err != nil || len(scrapes[1].data) != 1 || scrapes[1].url != healthy.URL {
+		t.Errorf("expected the healthy target's metrics, got %+v", scrapes[1])
+	}
+	if scrapes[2].err == nil {
+		t.Error("expected the broken target to fail")
+	}
+
+	msg := newMetricsMsg(scrapes)
+	if msg.err != nil {
+		t.Errorf("expected no error while a target is up, got %v", msg.err)
+	}
+	if len(msg.data) != 1 {
+		t.Errorf("expected the healthy target's metric, got %d metrics", len(msg.data))
+	}
+}
+
+func TestNewMetricsMsg_AllDown(t *testing.T) {
+	msg := newMetricsMsg([]targetScrape{
+		{url: "a", err: errors.New("connection refused")},
+		{url: "b", err: errors.New("no such host")},
+	})
+	if msg.err == nil || !strings.Contains(msg.err.Error(), "no such host") {
+		t.Errorf("expected every target's error, got %v", msg.err)
+	}
+}
+
+func TestDashboardModel_TargetHealth(t *testing.T) {
+	model := newDashboardModel([]string{"test_metric@a", "test_metric@b"}, nil, nil, time.Second, 80, 24)
+	up := func(url string) targetScrape {
+		return targetScrape{url: url, data: []fetcher.MetricData{{Name: "test_metric", Value: 1, Source: url}}, duration: time.Millisecond}
+	}
+	down := targetScrape{url: "b", err: errors.New("connection refused"), duration: 2 * time.Millisecond}
+
+	for _, scrapes := range [][]targetScrape{{up("a"), up("b")}, {up("a"), down}} {
+		result, _ := model.Update(newMetricsMsg(scrapes))
+		model = result.(dashboardModel)
+	}
+
+	if model.lastError != nil {
+		t.Errorf("expected no error while a target is up, got %v", model.lastError)
+	}
+	a, b := model.health["a"], model.health["b"]
+	if !a.up || b.up {
+		t.Errorf("expected a up and b down, got %+v and %+v", a, b)
+	}
+	if b.lastSuccess.IsZero() || b.duration != 2*time.Millisecond || b.lastError == nil {
+		t.Errorf("expected b's last success, duration and error, got %+v", b)
+	}
+
+	// The healthy target keeps updating, the other leaves a gap
+	if samples := model.graphs["test_metric@a"].buffer.Samples(); len(samples) != 2 || samples[1].IsGap() {
+		t.Errorf("expected a to keep updating, got %+v", samples)
+	}
+	if samples := model.graphs["test_metric@b"].buffer.Samples(); len(samples) != 2 || !samples[1].IsGap() {
+		t.Errorf("expected a gap for b, got %+v", samples)
+	}
+
+	model.width, model.height = 80, 24
+	view := model.View()
+	if !strings.Contains(view, "● up a") || !strings.Contains(view, "● down b: connection refused | last success") {
+		t.Errorf("expected target health in view, got:\n%s", view)
+	}
+}
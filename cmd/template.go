@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/buffer"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// templateFuncs are the helpers available to print --template, besides the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	"label":            templateLabel,
+	"quantile":         templateQuantile,
+	"humanizeBytes":    humanizeBytes,
+	"humanizeDuration": humanizeDuration,
+}
+
+// templateEncoder executes a template with each round of scrapes, as a
+// []fetcher.MetricData sorted by series
+type templateEncoder struct {
+	w        io.Writer
+	template *template.Template
+}
+
+func newTemplateEncoder(w io.Writer, text string) (*templateEncoder, error) {
+	tmpl, err := template.New("print").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return &templateEncoder{w: w, template: tmpl}, nil
+}
+
+func (e *templateEncoder) Encode(_ time.Time, metrics []fetcher.MetricData) error {
+	sorted := make([]fetcher.MetricData, len(metrics))
+	copy(sorted, metrics)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Identifier() < sorted[j].Identifier() })
+	return e.template.Execute(e.w, sorted)
+}
+
+// templateLabel returns the value of a label, or "" if the metric doesn't
+// have it. The metric comes last so that it can be piped: {{. | label "code"}}
+func templateLabel(name string, m fetcher.MetricData) string {
+	return m.Labels[name]
+}
+
+// templateQuantile returns the q-quantile of a summary, or estimates it from
+// the buckets of a histogram like histogram_quantile does, over every
+// observation the histogram has counted. It is NaN for other metrics, or a
+// summary without that quantile.
+func templateQuantile(q float64, m fetcher.MetricData) float64 {
+	switch strings.ToUpper(m.Type) {
+	case "SUMMARY":
+		for _, quantile := range m.Quantiles {
+			if float64(quantile.Quantile) == q {
+				return float64(quantile.Value)
+			}
+		}
+	case "HISTOGRAM", "GAUGE_HISTOGRAM":
+		if m.NativeHistogram != nil {
+			return m.NativeHistogram.Quantile(q)
+		}
+		if len(m.Buckets) > 0 {
+			return buffer.BucketQuantile(q, histogramBuckets(m))
+		}
+	}
+	return math.NaN()
+}
+
+// templateNumber converts the numbers a template may pass to a helper, such
+// as .Value, .SampleSum or the result of quantile, to a float
+func templateNumber(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case fetcher.NullableFloat64:
+		return float64(n), nil
+	case *fetcher.NullableFloat64:
+		if n != nil {
+			return float64(*n), nil
+		}
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case *uint64:
+		if n != nil {
+			return float64(*n), nil
+		}
+	case time.Duration:
+		return n.Seconds(), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("can't humanize %T", v)
+	}
+	return 0, fmt.Errorf("can't humanize a missing value")
+}
+
+// humanizeBytes formats a number of bytes with binary prefixes, like 1.5MiB
+func humanizeBytes(v any) (string, error) {
+	n, err := templateNumber(v)
+	if err != nil {
+		return "", err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'g', -1, 64), nil
+	}
+	prefix := ""
+	for _, p := range []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei"} {
+		if math.Abs(n) < 1024 {
+			break
+		}
+		n /= 1024
+		prefix = p
+	}
+	return fmt.Sprintf("%.4g%sB", n, prefix), nil
+}
+
+// humanizeDuration formats a number of seconds like prometheus' template
+// function of the same name: 1d 2h 3m 4s, or 1.5ms below a second
+func humanizeDuration(v any) (string, error) {
+	n, err := templateNumber(v)
+	if err != nil {
+		return "", err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'g', -1, 64), nil
+	}
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n == 0 {
+		return "0s", nil
+	}
+	if n >= 1 {
+		seconds := int64(n)
+		days, hours, minutes := seconds/86400, seconds/3600%24, seconds/60%60
+		seconds %= 60
+		switch {
+		case days > 0:
+			return fmt.Sprintf("%s%dd %dh %dm %ds", sign, days, hours, minutes, seconds), nil
+		case hours > 0:
+			return fmt.Sprintf("%s%dh %dm %ds", sign, hours, minutes, seconds), nil
+		case minutes > 0:
+			return fmt.Sprintf("%s%dm %ds", sign, minutes, seconds), nil
+		}
+		return fmt.Sprintf("%s%.4gs", sign, n), nil
+	}
+	switch {
+	case n >= 1e-3:
+		return fmt.Sprintf("%s%.4gms", sign, n*1e3), nil
+	case n >= 1e-6:
+		return fmt.Sprintf("%s%.4gus", sign, n*1e6), nil
+	}
+	return fmt.Sprintf("%s%.4gns", sign, n*1e9), nil
+}
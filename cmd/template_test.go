@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+func executeTemplate(t *testing.T, text string, metrics []fetcher.MetricData) string {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder, err := newTemplateEncoder(&buf, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Encode(time.Now(), metrics); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTemplateEncoder(t *testing.T) {
+	count, sum := uint64(10), fetcher.NullableFloat64(3)
+	metrics := []fetcher.MetricData{
+		{Name: "rpc_seconds", Type: "SUMMARY", SampleCount: &count, SampleSum: &sum,
+			Quantiles: []fetcher.SummaryQuantile{{Quantile: 0.5, Value: 0.2}, {Quantile: 0.99, Value: 0.0015}}},
+		{Name: "http_requests_total", Type: "COUNTER", Labels: map[string]string{"code": "500"}, Value: 2},
+		{Name: "http_requests_total", Type: "COUNTER", Labels: map[string]string{"code": "200"}, Value: 7},
+		{Name: "latency_seconds", Type: "HISTOGRAM", SampleCount: &count, SampleSum: &sum,
+			Buckets: []fetcher.HistogramBucket{{UpperBound: 1, CumulativeCount: 5}, {UpperBound: 2, CumulativeCount: 10}}},
+		{Name: "process_resident_memory_bytes", Type: "GAUGE", Value: 1572864},
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{len .}}`, "5"},
+		// Metrics are sorted by series
+		{`{{range .}}{{if eq .Name "http_requests_total"}}{{label "code" .}}={{.Value}} {{end}}{{end}}`, "200=7 500=2 "},
+		{`{{range .}}{{if eq .Name "rpc_seconds"}}{{. | quantile 0.99 | humanizeDuration}}{{end}}{{end}}`, "1.5ms"},
+		{`{{range .}}{{if eq .Name "latency_seconds"}}{{quantile 0.75 .}} {{.SampleSum | humanizeDuration}}{{end}}{{end}}`, "1.5 3s"},
+		{`{{range .}}{{if eq .Type "GAUGE"}}{{humanizeBytes .Value}}{{end}}{{end}}`, "1.5MiB"},
+		{`{{range .}}{{if eq .Type "GAUGE"}}{{quantile 0.5 .}} {{label "missing" .}}.{{end}}{{end}}`, "NaN ."},
+	}
+	for _, tc := range tests {
+		if got := executeTemplate(t, tc.template, metrics); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.template, tc.expected, got)
+		}
+	}
+
+	if _, err := newTemplateEncoder(&bytes.Buffer{}, "{{range .}"); err == nil || !strings.Contains(err.Error(), "invalid template") {
+		t.Errorf("Expected an invalid template error, got %v", err)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	var missing *fetcher.NullableFloat64
+	tests := []struct {
+		f        func(any) (string, error)
+		value    any
+		expected string // result, or empty for an error
+	}{
+		{humanizeBytes, 512, "512B"},
+		{humanizeBytes, 1024.0, "1KiB"},
+		{humanizeBytes, uint64(5) << 40, "5TiB"},
+		{humanizeBytes, "2048", "2KiB"},
+		{humanizeBytes, math.NaN(), "NaN"},
+		{humanizeDuration, 0, "0s"},
+		{humanizeDuration, 1.5, "1.5s"},
+		{humanizeDuration, 93784.0, "1d 2h 3m 4s"},
+		{humanizeDuration, -61.0, "-1m 1s"},
+		{humanizeDuration, 2 * time.Hour, "2h 0m 0s"},
+		{humanizeDuration, 0.000002, "2us"},
+		{humanizeDuration, 3e-9, "3ns"},
+		{humanizeDuration, missing, ""},
+		{humanizeDuration, "soon", ""},
+		{humanizeBytes, true, ""},
+	}
+	for _, tc := range tests {
+		got, err := tc.f(tc.value)
+		switch {
+		case tc.expected == "" && err == nil:
+			t.Errorf("%v: expected an error, got %q", tc.value, got)
+		case tc.expected != "" && got != tc.expected:
+			t.Errorf("%v: expected %q, got %q, %v", tc.value, tc.expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// watch scrapes every target each interval until ctx is done, handing each
+// round of scrapes to output along with the time it started
+func watch(ctx context.Context, fetchers []*fetcher.MetricsFetcher, interval time.Duration, output func(time.Time, []targetScrape) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t := time.Now()
+		scrapes := scrapeTargets(ctx, fetchers)
+		if ctx.Err() != nil {
+			// Scrapes cut short by Ctrl-C aren't worth reporting
+			return nil
+		}
+		if err := output(t, scrapes); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchLine is one line of print --watch --json output: a sample, or the
+// error of a failed scrape, with the scrape time and target. Histograms and
+// summaries are flattened into a line per bucket or quantile, plus _sum and
+// _count, so every sample line has the same fields.
+type watchLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target"`
+	Error     string    `json:"error,omitempty"`
+	*watchSample
+}
+
+type watchSample struct {
+	Name   string                  `json:"name"`
+	Labels map[string]string       `json:"labels"`
+	Value  fetcher.NullableFloat64 `json:"value"`
+}
+
+// writeWatchJSON writes a round of scrapes as newline-delimited JSON
+func writeWatchJSON(w io.Writer, t time.Time, scrapes []targetScrape) error {
+	encoder := json.NewEncoder(w)
+	for _, scrape := range scrapes {
+		if scrape.err != nil {
+			if err := encoder.Encode(watchLine{Timestamp: t.UTC(), Target: scrape.url, Error: scrape.err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, m := range scrape.data {
+			for _, s := range m.Samples() {
+				sample := &watchSample{Name: s.Name, Labels: s.Labels, Value: fetcher.NullableFloat64(s.Value)}
+				if err := encoder.Encode(watchLine{Timestamp: t.UTC(), Target: scrape.url, watchSample: sample}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// watchRow is a single value in the print --watch table
+type watchRow struct {
+	series string
+	value  float64
+}
+
+// watchRows flattens metrics into table rows. Histograms and summaries are
+// shown as their _count and _sum, as their buckets would flood the table.
+// The target is part of the series when there are several targets.
+func watchRows(metrics []fetcher.MetricData, withTarget bool) []watchRow {
+	var rows []watchRow
+	for _, m := range metrics {
+		series := func(suffix string) string {
+			s := m
+			s.Name += suffix
+			if withTarget {
+				return s.Identifier()
+			}
+			return s.Series()
+		}
+		switch strings.ToUpper(m.Type) {
+		case "HISTOGRAM", "GAUGE_HISTOGRAM", "SUMMARY":
+			var count, sum float64
+			if m.SampleCount != nil {
+				count = float64(*m.SampleCount)
+			}
+			if m.SampleSum != nil {
+				sum = float64(*m.SampleSum)
+			}
+			rows = append(rows, watchRow{series("_count"), count}, watchRow{series("_sum"), sum})
+		default:
+			rows = append(rows, watchRow{series(""), float64(m.Value)})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].series < rows[j].series })
+	return rows
+}
+
+// watchTable renders print --watch output for people, redrawn in place
+// like watch(1), with the values that changed since the previous scrape
+// highlighted along with how much they changed. A target that fails to be
+// scraped keeps its last rows, marked stale.
+type watchTable struct {
+	interval time.Duration
+	health   map[string]*targetHealth
+	previous map[string]float64              // value of each row at the previous scrape
+	last     map[string][]fetcher.MetricData // last successful scrape of each target
+}
+
+func newWatchTable(interval time.Duration) *watchTable {
+	return &watchTable{
+		interval: interval,
+		health:   make(map[string]*targetHealth),
+		last:     make(map[string][]fetcher.MetricData),
+	}
+}
+
+// render renders a round of scrapes, and remembers its values for the next
+func (wt *watchTable) render(t time.Time, scrapes []targetScrape) string {
+	updateHealth(wt.health, scrapes, t)
+	var metrics, staleMetrics []fetcher.MetricData
+	for _, scrape := range scrapes {
+		if scrape.err != nil {
+			staleMetrics = append(staleMetrics, wt.last[scrape.url]...)
+			continue
+		}
+		wt.last[scrape.url] = scrape.data
+		metrics = append(metrics, scrape.data...)
+	}
+	stale := make(map[string]bool)
+	for _, row := range watchRows(staleMetrics, len(scrapes) > 1) {
+		stale[row.series] = true
+	}
+	rows := watchRows(append(metrics, staleMetrics...), len(scrapes) > 1)
+
+	changedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFF00"))
+	upStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00"))
+	downStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	staleStyle := lipgloss.NewStyle().Faint(true)
+
+	seriesWidth, valueWidth := len("SERIES"), len("VALUE")
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = strconv.FormatFloat(row.value, 'g', -1, 64)
+		seriesWidth = max(seriesWidth, len(row.series))
+		valueWidth = max(valueWidth, len(values[i]))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Every %s: %s\n", wt.interval, t.Format(time.DateTime))
+	fmt.Fprintf(&b, "%s\n\n", renderTargetHealth(wt.health, t))
+	fmt.Fprintf(&b, "%-*s  %*s  %s\n", seriesWidth, "SERIES", valueWidth, "VALUE", "CHANGE")
+
+	current := make(map[string]float64, len(rows))
+	for i, row := range rows {
+		current[row.series] = row.value
+		series := fmt.Sprintf("%-*s", seriesWidth, row.series)
+		value := fmt.Sprintf("%*s", valueWidth, values[i])
+
+		previous, seen := wt.previous[row.series]
+		var change string
+		switch {
+		case stale[row.series]:
+			change = staleStyle.Render("stale")
+			value = staleStyle.Render(value)
+		case wt.previous == nil:
+			// Nothing to compare the first scrape with
+		case !seen:
+			change = changedStyle.Render("new")
+			value = changedStyle.Render(value)
+		case row.value != previous && !(math.IsNaN(row.value) && math.IsNaN(previous)):
+			delta := row.value - previous
+			change = strconv.FormatFloat(delta, 'g', -1, 64)
+			if delta > 0 {
+				change = "+" + change
+			}
+			if delta < 0 {
+				change = downStyle.Render(change)
+			} else {
+				change = upStyle.Render(change)
+			}
+			value = changedStyle.Render(value)
+		}
+		fmt.Fprintln(&b, strings.TrimRight(series+"  "+value+"  "+change, " "))
+	}
+	wt.previous = current
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+func TestWriteWatchJSON(t *testing.T) {
+	count, sum := uint64(3), fetcher.NullableFloat64(1.5)
+	scrapes := []targetScrape{
+		{url: "http://a/metrics", data: []fetcher.MetricData{
+			{Name: "up", Type: "GAUGE", Labels: map[string]string{"job": "a"}, Value: 1},
+			{Name: "latency_seconds", Type: "HISTOGRAM", SampleCount: &count, SampleSum: &sum},
+		}},
+		{url: "http://b/metrics", err: errors.New("connection refused")},
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := writeWatchJSON(&buf, at, scrapes); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d: %v", len(lines), lines)
+	}
+
+	first := lines[0]
+	if first["timestamp"] != "2024-01-02T03:04:05Z" || first["target"] != "http://a/metrics" ||
+		first["name"] != "up" || first["value"] != 1.0 || first["labels"].(map[string]any)["job"] != "a" {
+		t.Errorf("unexpected sample line %v", first)
+	}
+	// The histogram is flattened into its _sum and _count
+	if lines[1]["name"] != "latency_seconds_sum" || lines[1]["value"] != 1.5 ||
+		lines[2]["name"] != "latency_seconds_count" || lines[2]["value"] != 3.0 {
+		t.Errorf("expected the histogram's sum and count, got %v and %v", lines[1], lines[2])
+	}
+	if _, ok := lines[2]["sample_count"]; ok {
+		t.Errorf("expected only the sample fields, got %v", lines[2])
+	}
+	if lines[3]["error"] != "connection refused" || lines[3]["target"] != "http://b/metrics" {
+		t.Errorf("unexpected error line %v", lines[3])
+	}
+	if _, ok := lines[3]["name"]; ok {
+		t.Errorf("expected an error line without sample fields, got %v", lines[3])
+	}
+}
+
+func TestWatchRows(t *testing.T) {
+	count, sum := uint64(4), fetcher.NullableFloat64(2)
+	metrics := []fetcher.MetricData{
+		{Name: "zz", Value: 1, Source: "http://a"},
+		{Name: "rpc_seconds", Type: "SUMMARY", SampleCount: &count, SampleSum: &sum, Labels: map[string]string{"op": "get"}, Source: "http://a"},
+	}
+
+	rows := watchRows(metrics, false)
+	expected := []watchRow{{`rpc_seconds_count{op="get"}`, 4}, {`rpc_seconds_sum{op="get"}`, 2}, {"zz", 1}}
+	if fmt.Sprint(rows) != fmt.Sprint(expected) {
+		t.Errorf("expected rows %v, got %v", expected, rows)
+	}
+
+	if rows := watchRows(metrics[:1], true); rows[0].series != "zz@http://a" {
+		t.Errorf("expected the target in the series, got %q", rows[0].series)
+	}
+}
+
+func TestWatchTable(t *testing.T) {
+	table := newWatchTable(time.Second)
+	at := time.Now()
+	scrape := func(values ...float64) []targetScrape {
+		var data []fetcher.MetricData
+		for i, v := range values {
+			data = append(data, fetcher.MetricData{Name: fmt.Sprintf("metric_%d", i), Value: fetcher.NullableFloat64(v)})
+		}
+		return []targetScrape{{url: "http://a", data: data}}
+	}
+
+	first := table.render(at, scrape(10, 20))
+	if !strings.Contains(first, "SERIES") || strings.Contains(first, "new") || strings.Contains(first, "+") {
+		t.Errorf("expected the first table to have no changes:\n%s", first)
+	}
+
+	second := table.render(at.Add(time.Second), scrape(15, 20, 1))
+	for _, expected := range []string{"metric_0     15  +5\n", "metric_1     20\n", "metric_2      1  new\n"} {
+		if !strings.Contains(second, expected) {
+			t.Errorf("expected %q in:\n%s", expected, second)
+		}
+	}
+
+	third := table.render(at.Add(2*time.Second), scrape(12.5, 20, 1))
+	if !strings.Contains(third, "metric_0   12.5  -2.5\n") {
+		t.Errorf("expected a decrease in:\n%s", third)
+	}
+
+	// A failed scrape keeps the target's last rows, marked stale, so they
+	// aren't new when it recovers
+	failed := table.render(at.Add(3*time.Second), []targetScrape{{url: "http://a", err: errors.New("connection refused")}})
+	for _, expected := range []string{"metric_0   12.5  stale\n", "metric_2      1  stale\n"} {
+		if !strings.Contains(failed, expected) {
+			t.Errorf("expected %q in:\n%s", expected, failed)
+		}
+	}
+	recovered := table.render(at.Add(4*time.Second), scrape(13, 20, 1))
+	if strings.Contains(recovered, "new") || strings.Contains(recovered, "stale") {
+		t.Errorf("expected no new or stale rows after recovering:\n%s", recovered)
+	}
+	if !strings.Contains(recovered, "metric_0     13  +0.5\n") {
+		t.Errorf("expected the change since the stale value in:\n%s", recovered)
+	}
+}
+
+func TestWatch_StopsWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "test_metric 1")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rounds := 0
+	err := watch(ctx, []*fetcher.MetricsFetcher{fetcher.New(server.URL, nil)}, time.Millisecond, func(_ time.Time, scrapes []targetScrape) error {
+		rounds++
+		if len(scrapes) != 1 || scrapes[0].err != nil {
+			t.Errorf("unexpected scrapes %+v", scrapes)
+		}
+		if rounds == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rounds != 3 {
+		t.Errorf("expected 3 rounds before stopping, got %d", rounds)
+	}
+}
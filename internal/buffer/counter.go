@@ -0,0 +1,92 @@
+package buffer
+
+// Counter functions treat samples as a monotonically increasing counter.
+// Like prometheus, any decrease in value is taken to be a counter reset: the
+// process restarted and the counter began again from zero. Gaps are skipped.
+// Unlike prometheus, results are not extrapolated to the edges of a range,
+// as the window is exactly the samples given.
+
+// Increase returns how much a counter increased across the samples,
+// or 0 and false if there are fewer than two values.
+func Increase(samples []Sample) (float64, bool) {
+	var increase, prev float64
+	n := 0
+	for _, s := range samples {
+		if s.IsGap() {
+			continue
+		}
+		if n > 0 {
+			increase += counterDelta(prev, s.Value)
+		}
+		prev = s.Value
+		n++
+	}
+	if n < 2 {
+		return 0, false
+	}
+	return increase, true
+}
+
+// Rate returns the average per-second increase of a counter between the
+// first and last values, or 0 and false if it cannot be computed.
+func Rate(samples []Sample) (float64, bool) {
+	first, last, ok := span(samples)
+	if !ok {
+		return 0, false
+	}
+	increase, _ := Increase(samples)
+	return increase / last.Time.Sub(first.Time).Seconds(), true
+}
+
+// IRate returns the per-second increase of a counter between the last two
+// values, or 0 and false if it cannot be computed.
+func IRate(samples []Sample) (float64, bool) {
+	var last, prev *Sample
+	for i := len(samples) - 1; i >= 0 && prev == nil; i-- {
+		if samples[i].IsGap() {
+			continue
+		}
+		if last == nil {
+			last = &samples[i]
+		} else {
+			prev = &samples[i]
+		}
+	}
+	if prev == nil {
+		return 0, false
+	}
+	elapsed := last.Time.Sub(prev.Time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return counterDelta(prev.Value, last.Value) / elapsed, true
+}
+
+// counterDelta returns the increase from prev to cur. After a reset the
+// counter started from zero, so the whole of cur is the increase.
+func counterDelta(prev, cur float64) float64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// span returns the first and last values, if they are far enough apart in
+// time to compute a rate.
+func span(samples []Sample) (first, last Sample, ok bool) {
+	found := false
+	for _, s := range samples {
+		if s.IsGap() {
+			continue
+		}
+		if !found {
+			first = s
+			found = true
+		}
+		last = s
+	}
+	if !found || !last.Time.After(first.Time) {
+		return first, last, false
+	}
+	return first, last, true
+}
@@ -0,0 +1,91 @@
+package buffer
+
+import (
+	"math"
+	"testing"
+)
+
+// counterSamples builds samples one second apart from the given values,
+// with NaN values as gaps
+func counterSamples(values ...float64) []Sample {
+	tb := NewTimestamped(len(values))
+	for i, v := range values {
+		tb.Push(at(float64(i)), v)
+	}
+	return tb.Samples()
+}
+
+func TestIncrease(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		expected float64
+		ok       bool
+	}{
+		{"empty", nil, 0, false},
+		{"single value", []float64{5}, 0, false},
+		{"steady", []float64{0, 10, 20, 30}, 30, true},
+		{"reset", []float64{100, 110, 5, 15}, 25, true},
+		{"reset to zero", []float64{100, 0}, 0, true},
+		{"gap", []float64{10, math.NaN(), 30}, 20, true},
+		{"reset across gap", []float64{50, math.NaN(), 20}, 20, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			increase, ok := Increase(counterSamples(tc.values...))
+			if ok != tc.ok {
+				t.Fatalf("expected ok=%v, got %v", tc.ok, ok)
+			}
+			if math.Abs(increase-tc.expected) > 0.001 {
+				t.Errorf("expected increase %f, got %f", tc.expected, increase)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	// 10/s, then the process restarts and counts 5/s from zero
+	rate, ok := Rate(counterSamples(0, 10, 20, 5, 10))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if math.Abs(rate-7.5) > 0.001 {
+		t.Errorf("expected rate 7.5, got %f", rate)
+	}
+
+	if _, ok := Rate(counterSamples(1)); ok {
+		t.Error("expected ok=false for a single value")
+	}
+
+	// Gaps count towards the elapsed time
+	rate, _ = Rate(counterSamples(0, math.NaN(), math.NaN(), 30))
+	if math.Abs(rate-10) > 0.001 {
+		t.Errorf("expected rate 10, got %f", rate)
+	}
+}
+
+func TestIRate(t *testing.T) {
+	rate, ok := IRate(counterSamples(0, 10, 40))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if math.Abs(rate-30) > 0.001 {
+		t.Errorf("expected rate 30, got %f", rate)
+	}
+
+	// After a reset, the new value is the increase
+	rate, _ = IRate(counterSamples(0, 100, 4))
+	if math.Abs(rate-4) > 0.001 {
+		t.Errorf("expected rate 4 after reset, got %f", rate)
+	}
+
+	// Trailing gaps are skipped, and their time isn't counted
+	rate, _ = IRate(counterSamples(0, 10, 20, math.NaN()))
+	if math.Abs(rate-10) > 0.001 {
+		t.Errorf("expected rate 10, got %f", rate)
+	}
+
+	if _, ok := IRate(counterSamples(1, math.NaN())); ok {
+		t.Error("expected ok=false for a single value")
+	}
+}
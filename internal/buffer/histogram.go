@@ -0,0 +1,205 @@
+package buffer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Bucket is a classic histogram bucket: the number of observations less
+// than or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// HistogramDelta is the change in a histogram's cumulative buckets between
+// the previous scrape and the scrape at Time.
+type HistogramDelta struct {
+	Time    time.Time
+	Buckets []Bucket
+}
+
+// HistogramBuffer stores the bucket deltas between a fixed number of
+// successive scrapes of a histogram, from which it estimates quantiles of
+// the observations made over the window, like prometheus'
+// histogram_quantile over a rate.
+type HistogramBuffer struct {
+	data     []HistogramDelta
+	capacity int
+	head     int // next write position
+	size     int // current number of deltas
+
+	prev []Bucket // buckets from the previous scrape
+}
+
+// NewHistogram creates a new HistogramBuffer holding up to capacity deltas.
+func NewHistogram(capacity int) *HistogramBuffer {
+	return &HistogramBuffer{
+		data:     make([]HistogramDelta, capacity),
+		capacity: capacity,
+	}
+}
+
+// Push records the cumulative buckets of a scrape at t, storing the delta
+// from the previous scrape. The first scrape only sets the baseline. If any
+// count went down, or the bucket layout changed, the histogram was reset and
+// the buckets themselves are the delta.
+func (hb *HistogramBuffer) Push(t time.Time, buckets []Bucket) {
+	buckets = sortBuckets(buckets)
+	prev := hb.prev
+	hb.prev = buckets
+	if prev == nil {
+		return
+	}
+
+	delta := make([]Bucket, len(buckets))
+	copy(delta, buckets)
+	if sameBounds(prev, buckets) {
+		for i := range delta {
+			delta[i].Count -= prev[i].Count
+			if delta[i].Count < 0 {
+				copy(delta, buckets)
+				break
+			}
+		}
+	}
+
+	hb.data[hb.head] = HistogramDelta{Time: t, Buckets: delta}
+	hb.head = (hb.head + 1) % hb.capacity
+	if hb.size < hb.capacity {
+		hb.size++
+	}
+}
+
+// Len returns the current number of deltas in the buffer.
+func (hb *HistogramBuffer) Len() int {
+	return hb.size
+}
+
+// Deltas returns the buffered deltas in chronological order (oldest first).
+// Returns nil if the buffer is empty.
+func (hb *HistogramBuffer) Deltas() []HistogramDelta {
+	if hb.size == 0 {
+		return nil
+	}
+	result := make([]HistogramDelta, hb.size)
+	start := (hb.head - hb.size + hb.capacity) % hb.capacity
+	for i := 0; i < hb.size; i++ {
+		result[i] = hb.data[(start+i)%hb.capacity]
+	}
+	return result
+}
+
+// Window returns the cumulative buckets of all observations made over the
+// buffered deltas, or nil if the buffer is empty.
+func (hb *HistogramBuffer) Window() []Bucket {
+	var all [][]Bucket
+	for _, delta := range hb.Deltas() {
+		all = append(all, delta.Buckets)
+	}
+	return MergeBuckets(all...)
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) of the observations made
+// over the window. Returns 0 and false if there were none.
+func (hb *HistogramBuffer) Quantile(q float64) (float64, bool) {
+	v := BucketQuantile(q, hb.Window())
+	if math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// MergeBuckets adds up the counts of buckets with the same upper bound,
+// like prometheus' sum by (le).
+func MergeBuckets(histograms ...[]Bucket) []Bucket {
+	counts := make(map[float64]float64)
+	for _, buckets := range histograms {
+		for _, b := range buckets {
+			counts[b.UpperBound] += b.Count
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	merged := make([]Bucket, 0, len(counts))
+	for bound, count := range counts {
+		merged = append(merged, Bucket{UpperBound: bound, Count: count})
+	}
+	return sortBuckets(merged)
+}
+
+// BucketQuantile estimates the q-quantile (0 <= q <= 1) from cumulative
+// buckets the same way prometheus' histogram_quantile does: by linear
+// interpolation within the bucket the quantile falls in, assuming the
+// lowest bucket starts at 0 if its upper bound is positive. Quantiles in
+// the +Inf bucket return the highest finite upper bound. Returns NaN if
+// there is no +Inf bucket or no observations.
+func BucketQuantile(q float64, buckets []Bucket) float64 {
+	if math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+	buckets = sortBuckets(buckets)
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		return math.NaN()
+	}
+	// Counts may be slightly non-monotonic after float arithmetic
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].Count < buckets[i-1].Count {
+			buckets[i].Count = buckets[i-1].Count
+		}
+	}
+	total := buckets[len(buckets)-1].Count
+	if total == 0 {
+		return math.NaN()
+	}
+
+	rank := q * total
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].Count >= rank })
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].UpperBound
+	}
+	if b == 0 && buckets[0].UpperBound <= 0 {
+		return buckets[0].UpperBound
+	}
+
+	start, countBefore := 0.0, 0.0
+	if b > 0 {
+		start = buckets[b-1].UpperBound
+		countBefore = buckets[b-1].Count
+	}
+	end := buckets[b].UpperBound
+	inBucket := buckets[b].Count - countBefore
+	if inBucket == 0 {
+		return end
+	}
+	return start + (end-start)*(rank-countBefore)/inBucket
+}
+
+// sortBuckets returns a copy of buckets sorted by upper bound
+func sortBuckets(buckets []Bucket) []Bucket {
+	sorted := make([]Bucket, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].UpperBound < sorted[j].UpperBound })
+	return sorted
+}
+
+// sameBounds reports whether two sorted bucket lists have the same upper bounds
+func sameBounds(a, b []Bucket) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].UpperBound != b[i].UpperBound {
+			return false
+		}
+	}
+	return true
+}
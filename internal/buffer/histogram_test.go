@@ -0,0 +1,124 @@
+package buffer
+
+import (
+	"math"
+	"testing"
+)
+
+// buckets builds cumulative buckets with bounds 1, 2, 4 and +Inf
+func buckets(counts ...float64) []Bucket {
+	bounds := []float64{1, 2, 4, math.Inf(1)}
+	result := make([]Bucket, len(counts))
+	for i, c := range counts {
+		result[i] = Bucket{UpperBound: bounds[i], Count: c}
+	}
+	return result
+}
+
+func TestBucketQuantile(t *testing.T) {
+	b := buckets(10, 20, 40, 40)
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0.25, 1},    // rank 10 is the top of the first bucket
+		{0.125, 0.5}, // interpolated from 0 in the first bucket
+		{0.5, 2},
+		{0.75, 3},
+		{1, 4},
+	}
+	for _, tc := range tests {
+		if got := BucketQuantile(tc.q, b); math.Abs(got-tc.expected) > 1e-9 {
+			t.Errorf("quantile %g: expected %f, got %f", tc.q, tc.expected, got)
+		}
+	}
+
+	// Quantiles in the +Inf bucket return the highest finite bound
+	if got := BucketQuantile(0.99, buckets(1, 1, 1, 10)); got != 4 {
+		t.Errorf("expected 4 for a quantile in the +Inf bucket, got %f", got)
+	}
+	if !math.IsNaN(BucketQuantile(0.5, buckets(0, 0, 0, 0))) {
+		t.Error("expected NaN without observations")
+	}
+	if !math.IsNaN(BucketQuantile(0.5, buckets(1, 2, 3))) {
+		t.Error("expected NaN without a +Inf bucket")
+	}
+}
+
+func TestHistogramBuffer_Deltas(t *testing.T) {
+	hb := NewHistogram(10)
+	if _, ok := hb.Quantile(0.5); ok {
+		t.Error("expected ok=false for empty buffer")
+	}
+
+	// The first scrape is only a baseline: its observations happened before
+	// the window started, all of them under 1
+	hb.Push(at(1), buckets(100, 100, 100, 100))
+	if hb.Len() != 0 {
+		t.Errorf("expected no deltas after the first scrape, got %d", hb.Len())
+	}
+
+	// New observations all fall in (2,4]
+	hb.Push(at(2), buckets(100, 100, 110, 110))
+	hb.Push(at(3), buckets(100, 100, 120, 120))
+	if hb.Len() != 2 {
+		t.Fatalf("expected 2 deltas, got %d", hb.Len())
+	}
+	p50, ok := hb.Quantile(0.5)
+	if !ok || p50 != 3 {
+		t.Errorf("expected p50 3, got %f", p50)
+	}
+
+	window := hb.Window()
+	if window[2].Count != 20 || window[3].Count != 20 {
+		t.Errorf("expected 20 observations in the window, got %v", window)
+	}
+
+	deltas := hb.Deltas()
+	if len(deltas) != 2 || !deltas[1].Time.Equal(at(3)) {
+		t.Fatalf("expected deltas ending at the last scrape, got %+v", deltas)
+	}
+	if deltas[1].Buckets[2].Count != 10 || deltas[1].Buckets[1].Count != 0 {
+		t.Errorf("unexpected delta %v", deltas[1].Buckets)
+	}
+}
+
+func TestHistogramBuffer_Reset(t *testing.T) {
+	hb := NewHistogram(10)
+	hb.Push(at(4), buckets(100, 100, 100, 100))
+	// The process restarted and observed 4 values under 1
+	hb.Push(at(5), buckets(4, 4, 4, 4))
+
+	window := hb.Window()
+	if window[3].Count != 4 {
+		t.Errorf("expected the reset histogram to count as the delta, got %v", window)
+	}
+	if p99, _ := hb.Quantile(0.99); p99 > 1 {
+		t.Errorf("expected p99 under 1, got %f", p99)
+	}
+}
+
+func TestHistogramBuffer_Capacity(t *testing.T) {
+	hb := NewHistogram(2)
+	hb.Push(at(6), buckets(0, 0, 0, 0))
+	hb.Push(at(7), buckets(10, 10, 10, 10)) // 10 under 1, then rotated out
+	hb.Push(at(8), buckets(10, 20, 20, 20))
+	hb.Push(at(9), buckets(10, 30, 30, 30))
+
+	if hb.Len() != 2 {
+		t.Errorf("expected 2 deltas, got %d", hb.Len())
+	}
+	if p50, _ := hb.Quantile(0.5); p50 != 1.5 {
+		t.Errorf("expected only observations in (1,2] to remain, got p50 %f", p50)
+	}
+}
+
+func TestMergeBuckets(t *testing.T) {
+	merged := MergeBuckets(buckets(1, 2, 3, 4), buckets(10, 20, 30, 40))
+	if len(merged) != 4 || merged[0].Count != 11 || merged[3].Count != 44 {
+		t.Errorf("unexpected merged buckets %v", merged)
+	}
+	if MergeBuckets() != nil {
+		t.Error("expected nil when merging nothing")
+	}
+}
@@ -0,0 +1,299 @@
+package buffer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample is a value observed at a point in time. A NaN value marks a gap,
+// such as a failed scrape.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// IsGap reports whether the sample marks a gap rather than a value.
+func (s Sample) IsGap() bool {
+	return math.IsNaN(s.Value)
+}
+
+// TimestampedBuffer stores a fixed number of timestamped samples in FIFO order.
+// When capacity is reached, oldest samples are overwritten.
+// Statistics use the real time between samples, and gaps are kept rather
+// than compressed away.
+type TimestampedBuffer struct {
+	data     []Sample
+	capacity int
+	head     int // next write position
+	size     int // current number of samples, including gaps
+}
+
+// NewTimestamped creates a new TimestampedBuffer with the specified capacity.
+func NewTimestamped(capacity int) *TimestampedBuffer {
+	return &TimestampedBuffer{
+		data:     make([]Sample, capacity),
+		capacity: capacity,
+	}
+}
+
+// Push adds a value observed at t, overwriting the oldest sample if at capacity.
+// NaN values are recorded as gaps.
+func (tb *TimestampedBuffer) Push(t time.Time, value float64) {
+	tb.data[tb.head] = Sample{Time: t, Value: value}
+	tb.head = (tb.head + 1) % tb.capacity
+	if tb.size < tb.capacity {
+		tb.size++
+	}
+}
+
+// PushGap records that no value could be observed at t.
+func (tb *TimestampedBuffer) PushGap(t time.Time) {
+	tb.Push(t, math.NaN())
+}
+
+// Samples returns all samples, including gaps, in chronological order (oldest first).
+// Returns nil if the buffer is empty.
+func (tb *TimestampedBuffer) Samples() []Sample {
+	if tb.size == 0 {
+		return nil
+	}
+	result := make([]Sample, tb.size)
+	start := (tb.head - tb.size + tb.capacity) % tb.capacity
+	for i := 0; i < tb.size; i++ {
+		result[i] = tb.data[(start+i)%tb.capacity]
+	}
+	return result
+}
+
+// Values returns the values in chronological order, skipping gaps.
+// Returns nil if the buffer holds no values.
+func (tb *TimestampedBuffer) Values() []float64 {
+	var result []float64
+	for _, s := range tb.Samples() {
+		if !s.IsGap() {
+			result = append(result, s.Value)
+		}
+	}
+	return result
+}
+
+// valid returns the samples that are not gaps, oldest first.
+func (tb *TimestampedBuffer) valid() []Sample {
+	var result []Sample
+	for _, s := range tb.Samples() {
+		if !s.IsGap() {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Len returns the current number of samples in the buffer, including gaps.
+func (tb *TimestampedBuffer) Len() int {
+	return tb.size
+}
+
+// Capacity returns the maximum number of samples the buffer holds.
+func (tb *TimestampedBuffer) Capacity() int {
+	return tb.capacity
+}
+
+// Latest returns the most recent value and true,
+// or 0 and false if the buffer holds no values.
+func (tb *TimestampedBuffer) Latest() (float64, bool) {
+	for i := 1; i <= tb.size; i++ {
+		s := tb.data[(tb.head-i+tb.capacity)%tb.capacity]
+		if !s.IsGap() {
+			return s.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Min returns the minimum value in the buffer, or 0 and false if empty.
+func (tb *TimestampedBuffer) Min() (float64, bool) {
+	values := tb.Values()
+	if len(values) == 0 {
+		return 0, false
+	}
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min, true
+}
+
+// Max returns the maximum value in the buffer, or 0 and false if empty.
+func (tb *TimestampedBuffer) Max() (float64, bool) {
+	values := tb.Values()
+	if len(values) == 0 {
+		return 0, false
+	}
+	max := values[0]
+	for _, v := range values[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max, true
+}
+
+// Avg returns the average of all values in the buffer, or 0 and false if empty.
+func (tb *TimestampedBuffer) Avg() (float64, bool) {
+	values := tb.Values()
+	if len(values) == 0 {
+		return 0, false
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values)), true
+}
+
+// StdDev returns the standard deviation of values in the buffer.
+func (tb *TimestampedBuffer) StdDev() (float64, bool) {
+	avg, ok := tb.Avg()
+	if !ok {
+		return 0, false
+	}
+	values := tb.Values()
+	sumSquares := 0.0
+	for _, v := range values {
+		diff := v - avg
+		sumSquares += diff * diff
+	}
+	return math.Sqrt(sumSquares / float64(len(values))), true
+}
+
+// CV returns the coefficient of variation (stddev/mean).
+func (tb *TimestampedBuffer) CV() (float64, bool) {
+	avg, ok := tb.Avg()
+	if !ok || avg == 0 {
+		return 0, false
+	}
+	stddev, _ := tb.StdDev()
+	return stddev / avg, true
+}
+
+// Trend returns 1 (up), -1 (down), or 0 (flat) based on the least squares
+// slope of the values over time. The trend is flat unless the slope accounts
+// for a change of more than 5% of the average (minimum 0.01) over the window.
+func (tb *TimestampedBuffer) Trend() int {
+	samples := tb.valid()
+	if len(samples) < 2 {
+		return 0
+	}
+	start := samples[0].Time
+	span := samples[len(samples)-1].Time.Sub(start).Seconds()
+	if span <= 0 {
+		return 0
+	}
+
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.Time.Sub(start).Seconds()
+		sumY += s.Value
+	}
+	n := float64(len(samples))
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX float64
+	for _, s := range samples {
+		dx := s.Time.Sub(start).Seconds() - meanX
+		cov += dx * (s.Value - meanY)
+		varX += dx * dx
+	}
+	change := cov / varX * span
+
+	threshold := math.Abs(meanY) * 0.05
+	if threshold < 0.01 {
+		threshold = 0.01
+	}
+	if change > threshold {
+		return 1 // trending up
+	} else if change < -threshold {
+		return -1 // trending down
+	}
+	return 0 // flat
+}
+
+// Percentile returns the value at the given percentile (0-100), weighting
+// each value by how long it was current: the time until the next sample or
+// gap. The latest value is weighted by the average of the others, so a
+// single slow scrape doesn't dominate.
+func (tb *TimestampedBuffer) Percentile(p float64) (float64, bool) {
+	samples := tb.Samples()
+	if p < 0 || p > 100 {
+		return 0, false
+	}
+
+	type weighted struct {
+		value  float64
+		weight float64
+	}
+	var values []weighted
+	total := 0.0
+	last := -1
+	for i, s := range samples {
+		if s.IsGap() {
+			continue
+		}
+		if i == len(samples)-1 {
+			last = len(values)
+			values = append(values, weighted{value: s.Value})
+			continue
+		}
+		w := samples[i+1].Time.Sub(s.Time).Seconds()
+		values = append(values, weighted{value: s.Value, weight: w})
+		total += w
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	if last >= 0 && len(values) > 1 {
+		values[last].weight = total / float64(len(values)-1)
+		total += values[last].weight
+	}
+	if total <= 0 {
+		// No elapsed time to weight by, so count every value equally
+		for i := range values {
+			values[i].weight = 1
+		}
+		total = float64(len(values))
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+	target := p / 100 * total
+	cumulative := 0.0
+	for _, v := range values {
+		cumulative += v.weight
+		if v.weight > 0 && cumulative >= target {
+			return v.value, true
+		}
+	}
+	return values[len(values)-1].value, true
+}
+
+// Median returns the median (p50) value in the buffer.
+func (tb *TimestampedBuffer) Median() (float64, bool) {
+	return tb.Percentile(50)
+}
+
+// Rate returns the rate of change per second between the oldest and latest
+// values, using the real time elapsed between them.
+func (tb *TimestampedBuffer) Rate() (float64, bool) {
+	samples := tb.valid()
+	if len(samples) < 2 {
+		return 0, false
+	}
+	oldest := samples[0]
+	latest := samples[len(samples)-1]
+	elapsed := latest.Time.Sub(oldest.Time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (latest.Value - oldest.Value) / elapsed, true
+}
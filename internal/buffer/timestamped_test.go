@@ -0,0 +1,220 @@
+package buffer
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var epoch = time.Unix(1700000000, 0)
+
+// at returns the time n seconds after epoch
+func at(n float64) time.Time {
+	return epoch.Add(time.Duration(n * float64(time.Second)))
+}
+
+func TestTimestampedBuffer_PushOverflow(t *testing.T) {
+	tb := NewTimestamped(3)
+	for i := 0; i < 5; i++ {
+		tb.Push(at(float64(i)), float64(i))
+	}
+
+	samples := tb.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(samples))
+	}
+	for i, s := range samples {
+		if s.Value != float64(i+2) || !s.Time.Equal(at(float64(i+2))) {
+			t.Errorf("sample %d: expected %d at %v, got %+v", i, i+2, at(float64(i+2)), s)
+		}
+	}
+	if tb.Capacity() != 3 {
+		t.Errorf("expected capacity 3, got %d", tb.Capacity())
+	}
+}
+
+func TestTimestampedBuffer_Gaps(t *testing.T) {
+	tb := NewTimestamped(30)
+	tb.Push(at(0), 1)
+	tb.PushGap(at(1))
+	tb.Push(at(2), 3)
+	tb.PushGap(at(3))
+
+	if tb.Len() != 4 {
+		t.Errorf("expected gaps to be kept, got %d samples", tb.Len())
+	}
+	samples := tb.Samples()
+	if !samples[1].IsGap() || samples[0].IsGap() {
+		t.Errorf("unexpected gaps in %+v", samples)
+	}
+
+	values := tb.Values()
+	if len(values) != 2 || values[0] != 1 || values[1] != 3 {
+		t.Errorf("expected values to skip gaps, got %v", values)
+	}
+	if val, ok := tb.Latest(); !ok || val != 3 {
+		t.Errorf("expected latest value 3, got %f", val)
+	}
+	if avg, _ := tb.Avg(); avg != 2 {
+		t.Errorf("expected avg 2, got %f", avg)
+	}
+
+	tb = NewTimestamped(30)
+	tb.PushGap(at(0))
+	if _, ok := tb.Latest(); ok {
+		t.Error("expected ok=false for a buffer with only gaps")
+	}
+	if _, ok := tb.Min(); ok {
+		t.Error("expected ok=false for a buffer with only gaps")
+	}
+}
+
+func TestTimestampedBuffer_Rate(t *testing.T) {
+	tb := NewTimestamped(30)
+
+	// Empty buffer
+	if _, ok := tb.Rate(); ok {
+		t.Error("expected ok=false for empty buffer")
+	}
+
+	// Single value - need at least 2
+	tb.Push(at(0), 0)
+	if _, ok := tb.Rate(); ok {
+		t.Error("expected ok=false for single value")
+	}
+
+	// A slow scrape: 40 over 5 seconds, whatever the number of samples
+	tb.Push(at(1), 10)
+	tb.Push(at(2), 20)
+	tb.Push(at(5), 40)
+	rate, ok := tb.Rate()
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if math.Abs(rate-8.0) > 0.001 {
+		t.Errorf("expected rate=8.0, got %f", rate)
+	}
+
+	// Failed scrapes don't shorten the elapsed time
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 0)
+	tb.PushGap(at(1))
+	tb.PushGap(at(2))
+	tb.Push(at(3), 30)
+	rate, _ = tb.Rate()
+	if math.Abs(rate-10.0) > 0.001 {
+		t.Errorf("expected rate=10.0, got %f", rate)
+	}
+
+	// Samples at the same time have no elapsed time
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 1)
+	tb.Push(at(0), 2)
+	if _, ok := tb.Rate(); ok {
+		t.Error("expected ok=false without elapsed time")
+	}
+}
+
+func TestTimestampedBuffer_Trend(t *testing.T) {
+	tb := NewTimestamped(30)
+	if tb.Trend() != 0 {
+		t.Error("expected trend=0 for empty buffer")
+	}
+
+	// Upward trend
+	for i := 0; i < 5; i++ {
+		tb.Push(at(float64(i)), float64(i+1))
+	}
+	if tb.Trend() != 1 {
+		t.Errorf("expected trend=1 (up), got %d", tb.Trend())
+	}
+
+	// Downward trend
+	tb = NewTimestamped(30)
+	for i := 0; i < 5; i++ {
+		tb.Push(at(float64(i)), float64(5-i))
+	}
+	if tb.Trend() != -1 {
+		t.Errorf("expected trend=-1 (down), got %d", tb.Trend())
+	}
+
+	// Flat trend (same values, irregular scrapes)
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 10)
+	tb.Push(at(50), 10)
+	tb.Push(at(99), 10)
+	tb.Push(at(99.5), 10)
+	tb.Push(at(100), 10)
+	if tb.Trend() != 0 {
+		t.Errorf("expected trend=0 (flat), got %d", tb.Trend())
+	}
+}
+
+func TestTimestampedBuffer_Percentile(t *testing.T) {
+	tb := NewTimestamped(30)
+	if _, ok := tb.Percentile(50); ok {
+		t.Error("expected ok=false for empty buffer")
+	}
+
+	// Evenly spaced values count equally
+	for i := 1; i <= 5; i++ {
+		tb.Push(at(float64(i)), float64(i))
+	}
+	if med, _ := tb.Median(); med != 3 {
+		t.Errorf("expected median 3, got %f", med)
+	}
+	if _, ok := tb.Percentile(101); ok {
+		t.Error("expected ok=false for out of range percentile")
+	}
+
+	// 100 was current for 8 of the 10 seconds, so it is the median even
+	// though it is only one of three values
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 1)
+	tb.Push(at(1), 100)
+	tb.Push(at(9), 2)
+	if med, _ := tb.Median(); med != 100 {
+		t.Errorf("expected time-weighted median 100, got %f", med)
+	}
+	if p0, _ := tb.Percentile(0); p0 != 1 {
+		t.Errorf("expected p0 1, got %f", p0)
+	}
+	if p100, _ := tb.Percentile(100); p100 != 100 {
+		t.Errorf("expected p100 100, got %f", p100)
+	}
+
+	// A value followed by a gap only counts until the gap
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 1)
+	tb.PushGap(at(1))
+	tb.Push(at(9), 2)
+	tb.Push(at(10), 2)
+	if med, _ := tb.Median(); med != 2 {
+		t.Errorf("expected median 2, got %f", med)
+	}
+
+	// A single value
+	tb = NewTimestamped(30)
+	tb.Push(at(0), 7)
+	if p95, ok := tb.Percentile(95); !ok || p95 != 7 {
+		t.Errorf("expected p95 7, got %f", p95)
+	}
+}
+
+func TestTimestampedBuffer_StdDevAndCV(t *testing.T) {
+	tb := NewTimestamped(30)
+	if _, ok := tb.CV(); ok {
+		t.Error("expected ok=false for empty buffer")
+	}
+
+	for i, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		tb.Push(at(float64(i)), v)
+	}
+	tb.PushGap(at(8))
+	if stddev, _ := tb.StdDev(); math.Abs(stddev-2) > 0.001 {
+		t.Errorf("expected stddev 2, got %f", stddev)
+	}
+	if cv, _ := tb.CV(); math.Abs(cv-0.4) > 0.001 {
+		t.Errorf("expected cv 0.4, got %f", cv)
+	}
+}
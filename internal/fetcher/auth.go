@@ -0,0 +1,126 @@
+package fetcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ClientConfig holds the authentication and TLS settings for scraping a
+// target, like the http client settings of a prometheus scrape config
+type ClientConfig struct {
+	// BearerTokenFile is read on every scrape, so that tokens can be rotated
+	BearerTokenFile string
+
+	// BasicAuthPasswordFile is read on every scrape, like BearerTokenFile
+	BasicAuthUser         string
+	BasicAuthPasswordFile string
+
+	CAFile             string // CA certificates to verify the target with, instead of the system's
+	CertFile           string // client certificate, for mutual TLS
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Headers are set on every scrape request. Setting Host changes the
+	// request's Host rather than adding a header.
+	Headers map[string]string
+}
+
+// Configure builds the fetcher's http client from cfg. It returns an error
+// if the certificates can't be loaded, or a password or token file can't be
+// read. The settings are ignored by targets that aren't scraped over HTTP.
+func (mf *MetricsFetcher) Configure(cfg ClientConfig) error {
+	if cfg.BearerTokenFile != "" && cfg.BasicAuthUser != "" {
+		return errors.New("at most one of bearer token and basic auth can be configured")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return errors.New("client certificate and key must be configured together")
+	}
+	// Catch mistyped paths now, rather than on every scrape
+	for _, file := range []string{cfg.BearerTokenFile, cfg.BasicAuthPasswordFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.ReadFile(file); err != nil {
+			return fmt.Errorf("failed to read credentials: %w", err)
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t, ok := mf.transport.(*httpTransport)
+	if !ok {
+		return nil
+	}
+	transport := newHTTPTransport(t.socket)
+	transport.TLSClientConfig = tlsConfig
+	t.client = &http.Client{Transport: &authTransport{cfg: cfg, next: transport}}
+	return nil
+}
+
+// authTransport adds credentials and headers to every request
+type authTransport struct {
+	cfg  ClientConfig
+	next http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.cfg.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	if t.cfg.BearerTokenFile != "" {
+		token, err := readSecret(t.cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if t.cfg.BasicAuthUser != "" {
+		var password string
+		if t.cfg.BasicAuthPasswordFile != "" {
+			var err error
+			if password, err = readSecret(t.cfg.BasicAuthPasswordFile); err != nil {
+				return nil, fmt.Errorf("failed to read basic auth password: %w", err)
+			}
+		}
+		req.SetBasicAuth(t.cfg.BasicAuthUser, password)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// readSecret reads a token or password file, ignoring surrounding whitespace
+// such as the trailing newline most editors add
+func readSecret(file string) (string, error) {
+	secret, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
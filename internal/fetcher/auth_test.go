@@ -0,0 +1,209 @@
+package fetcher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeCA writes the certificate of a TLS test server as a CA file
+func writeCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	return writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+}
+
+// writeClientCert writes a self-signed client certificate and its key,
+// returning their paths and the certificate
+func writeClientCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hrmm"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = writeFile(t, "client.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	keyFile = writeFile(t, "client-key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certFile, keyFile, cert
+}
+
+func TestConfigure_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	defer server.Close()
+
+	// The test server's certificate isn't trusted by default
+	f := New(server.URL, nil)
+	if err := f.Configure(ClientConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err == nil {
+		t.Error("Expected an unknown certificate authority to fail")
+	}
+
+	if err := f.Configure(ClientConfig{CAFile: writeCA(t, server)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Errorf("Expected the CA file to be trusted, got %v", err)
+	}
+
+	if err := f.Configure(ClientConfig{InsecureSkipVerify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Errorf("Expected verification to be skipped, got %v", err)
+	}
+}
+
+func TestConfigure_ClientCertificate(t *testing.T) {
+	certFile, keyFile, cert := writeClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	f := New(server.URL, nil)
+	if err := f.Configure(ClientConfig{CAFile: writeCA(t, server)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err == nil {
+		t.Error("Expected the scrape to fail without a client certificate")
+	}
+
+	if err := f.Configure(ClientConfig{CAFile: writeCA(t, server), CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Errorf("Expected the client certificate to be accepted, got %v", err)
+	}
+}
+
+func TestConfigure_Credentials(t *testing.T) {
+	var authorization, scope, host string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		scope = r.Header.Get("X-Scope-OrgID")
+		host = r.Host
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	defer server.Close()
+	f := New(server.URL, nil)
+
+	tokenFile := writeFile(t, "token", "s3cret\n")
+	err := f.Configure(ClientConfig{
+		InsecureSkipVerify: true,
+		BearerTokenFile:    tokenFile,
+		Headers:            map[string]string{"X-Scope-OrgID": "team-a", "Host": "exporter.internal"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer s3cret" {
+		t.Errorf("Expected the bearer token without its newline, got %q", authorization)
+	}
+	if scope != "team-a" || host != "exporter.internal" {
+		t.Errorf("Expected custom headers, got X-Scope-OrgID %q and Host %q", scope, host)
+	}
+
+	// Token files are read on every scrape, so rotated tokens are picked up
+	if err := os.WriteFile(tokenFile, []byte("rotated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer rotated" {
+		t.Errorf("Expected the rotated token, got %q", authorization)
+	}
+
+	err = f.Configure(ClientConfig{
+		InsecureSkipVerify:    true,
+		BasicAuthUser:         "prometheus",
+		BasicAuthPasswordFile: writeFile(t, "password", "hunter2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	req := &http.Request{Header: http.Header{"Authorization": {authorization}}}
+	if user, password, ok := req.BasicAuth(); !ok || user != "prometheus" || password != "hunter2" {
+		t.Errorf("Expected basic auth, got %q", authorization)
+	}
+}
+
+func TestConfigure_Errors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	tests := []struct {
+		name     string
+		cfg      ClientConfig
+		expected string
+	}{
+		{"missing token", ClientConfig{BearerTokenFile: missing}, "failed to read credentials"},
+		{"missing CA", ClientConfig{CAFile: missing}, "failed to read CA file"},
+		{"invalid CA", ClientConfig{CAFile: writeFile(t, "ca.pem", "not a certificate")}, "no certificates found"},
+		{"cert without key", ClientConfig{CertFile: missing}, "must be configured together"},
+		{"two kinds of auth", ClientConfig{BearerTokenFile: missing, BasicAuthUser: "user"}, "at most one"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := New("https://localhost/metrics", nil).Configure(tc.cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package fetcher
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// labelValueEscaper escapes label values as the exposition formats require
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// formatLabelPairs formats labels as key="value",key2="value2", sorted by
+// name, with values escaped so that the result can be parsed again
+func formatLabelPairs(labels map[string]string) string {
+	labelPairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		labelPairs = append(labelPairs, key+`="`+labelValueEscaper.Replace(value)+`"`)
+	}
+	sort.Strings(labelPairs) // Sort for consistent output
+	return strings.Join(labelPairs, ",")
+}
+
+// formatFloat formats a sample value the way the exposition formats do,
+// with as many digits as needed to parse back to the same value
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Families converts metrics back into metric families, the inverse of what
+// Fetch does. Families are sorted by name and their series by labels, so the
+// result doesn't depend on the order of the metrics. The help, type and unit
+// of a family are taken from its first metric.
+func Families(metrics []MetricData) []*dto.MetricFamily {
+	families := make(map[string]*dto.MetricFamily)
+	series := make(map[*dto.MetricFamily][]MetricData)
+	for _, m := range metrics {
+		family, ok := families[m.Name]
+		if !ok {
+			family = &dto.MetricFamily{
+				Name: &m.Name,
+				Type: metricType(m.Type).Enum(),
+			}
+			if m.Help != "" {
+				family.Help = &m.Help
+			}
+			if m.Unit != "" {
+				family.Unit = &m.Unit
+			}
+			families[m.Name] = family
+		}
+		series[family] = append(series[family], m)
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		members := series[family]
+		sort.SliceStable(members, func(i, j int) bool {
+			return members[i].Series() < members[j].Series()
+		})
+		for _, m := range members {
+			family.Metric = append(family.Metric, m.toMetric(family.GetType()))
+		}
+		result = append(result, family)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
+
+// metricType parses the type of a MetricData, defaulting to untyped
+func metricType(t string) dto.MetricType {
+	if value, ok := dto.MetricType_value[strings.ToUpper(t)]; ok {
+		return dto.MetricType(value)
+	}
+	return dto.MetricType_UNTYPED
+}
+
+// toMetric converts a single series back into a protobuf metric
+func (m MetricData) toMetric(metricType dto.MetricType) *dto.Metric {
+	metric := &dto.Metric{Label: labelPairs(m.Labels)}
+	value := float64(m.Value)
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		metric.Counter = &dto.Counter{
+			Value:            &value,
+			Exemplar:         m.Exemplar.toDTO(),
+			CreatedTimestamp: timeToTimestamp(m.Created),
+		}
+	case dto.MetricType_GAUGE:
+		metric.Gauge = &dto.Gauge{Value: &value}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		count, sum := m.sampleCount(), m.sampleSum()
+		h := &dto.Histogram{
+			SampleCount:      &count,
+			SampleSum:        &sum,
+			CreatedTimestamp: timeToTimestamp(m.Created),
+		}
+		for _, bucket := range m.Buckets {
+			upperBound, cumulativeCount := float64(bucket.UpperBound), bucket.CumulativeCount
+			h.Bucket = append(h.Bucket, &dto.Bucket{
+				UpperBound:      &upperBound,
+				CumulativeCount: &cumulativeCount,
+				Exemplar:        bucket.Exemplar.toDTO(),
+			})
+		}
+		if m.NativeHistogram != nil {
+			m.NativeHistogram.toDTO(h)
+		}
+		metric.Histogram = h
+	case dto.MetricType_SUMMARY:
+		count, sum := m.sampleCount(), m.sampleSum()
+		s := &dto.Summary{
+			SampleCount:      &count,
+			SampleSum:        &sum,
+			CreatedTimestamp: timeToTimestamp(m.Created),
+		}
+		for _, quantile := range m.Quantiles {
+			q, v := float64(quantile.Quantile), float64(quantile.Value)
+			s.Quantile = append(s.Quantile, &dto.Quantile{Quantile: &q, Value: &v})
+		}
+		metric.Summary = s
+	default:
+		metric.Untyped = &dto.Untyped{Value: &value}
+	}
+	return metric
+}
+
+// labelPairs converts labels into label pairs sorted by name
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].GetName() < pairs[j].GetName()
+	})
+	return pairs
+}
+
+func (e *Exemplar) toDTO() *dto.Exemplar {
+	if e == nil {
+		return nil
+	}
+	value := float64(e.Value)
+	return &dto.Exemplar{
+		Label:     labelPairs(e.Labels),
+		Value:     &value,
+		Timestamp: timeToTimestamp(e.Timestamp),
+	}
+}
+
+// toDTO sets the native buckets of a histogram, with float counts
+func (n NativeHistogram) toDTO(h *dto.Histogram) {
+	h.Schema = &n.Schema
+	h.ZeroThreshold = &n.ZeroThreshold
+	h.ZeroCountFloat = &n.ZeroCount
+	h.PositiveSpan = spansToDTO(n.PositiveSpans)
+	h.PositiveCount = n.PositiveBuckets
+	h.NegativeSpan = spansToDTO(n.NegativeSpans)
+	h.NegativeCount = n.NegativeBuckets
+}
+
+func spansToDTO(spans []BucketSpan) []*dto.BucketSpan {
+	var result []*dto.BucketSpan
+	for _, span := range spans {
+		result = append(result, &dto.BucketSpan{Offset: &span.Offset, Length: &span.Length})
+	}
+	return result
+}
+
+// timeToTimestamp converts an optional time into a protobuf timestamp
+func timeToTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// WriteText writes metrics in the prometheus text exposition format, with
+// HELP and TYPE comments for each family. The format has no units,
+// exemplars or created timestamps, so those are left out. Gauge histograms
+// are written as histograms, and native histogram buckets, which only the
+// protobuf format can carry, are written as a comment after their family.
+func WriteText(w io.Writer, metrics []MetricData) error {
+	for i, family := range Families(metrics) {
+		if i > 0 {
+			// Add blank line between metric families
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if family.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+			family.Type = dto.MetricType_HISTOGRAM.Enum()
+		}
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", family.GetName(), err)
+		}
+		for _, metric := range metrics {
+			if metric.Name != family.GetName() || metric.NativeHistogram == nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "# %s\n", metric.nativeHistogramString()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
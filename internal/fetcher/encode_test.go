@@ -0,0 +1,171 @@
+package fetcher
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// roundTripData exercises the values and labels that are easy to get wrong
+const roundTripData = `# HELP escapes Label values with "quotes", \\backslashes\\ and\nnewlines.
+# TYPE escapes gauge
+escapes{path="C:\\Temp\\",quote="say \"hi\"",newline="a\nb",empty=""} 1
+escapes{path="/",quote="",newline="",empty="x"} 2
+# HELP big_counter_total A counter too large for %g.
+# TYPE big_counter_total counter
+big_counter_total{instance="a"} 1.234567890123e+15
+big_counter_total{instance="b"} 9.007199254740991e+15
+big_counter_total{instance="c"} 0.1
+# TYPE special_values gauge
+special_values{v="nan"} NaN
+special_values{v="inf"} +Inf
+special_values{v="-inf"} -Inf
+special_values{v="tiny"} 5e-324
+special_values{v="negative"} -12.75
+# TYPE untyped_metric untyped
+untyped_metric 42
+# HELP latency_seconds Latency with "odd" bucket bounds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{handler="/a\"b",le="0.005"} 1
+latency_seconds_bucket{handler="/a\"b",le="0.1"} 7
+latency_seconds_bucket{handler="/a\"b",le="+Inf"} 9
+latency_seconds_sum{handler="/a\"b"} 0.30000000000000004
+latency_seconds_count{handler="/a\"b"} 9
+# TYPE rpc_seconds summary
+rpc_seconds{service="x\\y",quantile="0.5"} 0.2
+rpc_seconds{service="x\\y",quantile="0.99"} NaN
+rpc_seconds_sum{service="x\\y"} 1e+21
+rpc_seconds_count{service="x\\y"} 18446744073709551615
+`
+
+// parseText parses the text format, failing the test on error
+func parseText(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Failed to parse:\n%s\n%v", text, err)
+	}
+	return families
+}
+
+// convertAll converts parsed families into metrics, as Fetch does
+func convertAll(families map[string]*dto.MetricFamily) []MetricData {
+	var metrics []MetricData
+	for _, family := range families {
+		metrics = append(metrics, convertFamily(family)...)
+	}
+	return metrics
+}
+
+// canonicalText encodes families in a canonical order, so that families
+// can be compared even though NaN values never compare equal
+func canonicalText(t *testing.T, families map[string]*dto.MetricFamily) string {
+	t.Helper()
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		family := families[name]
+		for _, metric := range family.Metric {
+			sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+		}
+		sort.Slice(family.Metric, func(i, j int) bool {
+			return family.Metric[i].String() < family.Metric[j].String()
+		})
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestWriteText_RoundTrip(t *testing.T) {
+	original := parseText(t, roundTripData)
+	metrics := convertAll(original)
+
+	var printed bytes.Buffer
+	if err := WriteText(&printed, metrics); err != nil {
+		t.Fatal(err)
+	}
+	reparsed := parseText(t, printed.String())
+
+	if want, got := canonicalText(t, original), canonicalText(t, reparsed); want != got {
+		t.Errorf("Families changed in a round trip.\nOriginal:\n%s\nAfter printing:\n%s", want, got)
+	}
+
+	// Printing the reparsed families gives the same output again
+	var reprinted bytes.Buffer
+	if err := WriteText(&reprinted, convertAll(reparsed)); err != nil {
+		t.Fatal(err)
+	}
+	if printed.String() != reprinted.String() {
+		t.Errorf("Printing is not stable.\nFirst:\n%s\nSecond:\n%s", printed.String(), reprinted.String())
+	}
+}
+
+func TestWriteText_RoundTripMockData(t *testing.T) {
+	original := parseText(t, mockMetricsData)
+	var printed bytes.Buffer
+	if err := WriteText(&printed, convertAll(original)); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := canonicalText(t, original), canonicalText(t, parseText(t, printed.String())); want != got {
+		t.Errorf("Families changed in a round trip.\nOriginal:\n%s\nAfter printing:\n%s", want, got)
+	}
+}
+
+func TestWriteText_OpenMetricsRoundTrip(t *testing.T) {
+	// OpenMetrics only features, like units and exemplars, are dropped, but
+	// the samples survive being printed in the text format
+	original, err := parseOpenMetrics(strings.NewReader(mockOpenMetricsData), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed bytes.Buffer
+	if err := WriteText(&printed, convertAll(original)); err != nil {
+		t.Fatal(err)
+	}
+	reparsed := parseText(t, printed.String())
+	for _, name := range []string{"http_requests_total", "request_duration_seconds"} {
+		if got, want := len(reparsed[name].GetMetric()), len(original[name].GetMetric()); got != want {
+			t.Errorf("Expected %d %s series after a round trip, got %d", want, name, got)
+		}
+	}
+	if strings.Contains(printed.String(), "# UNIT") || strings.Contains(printed.String(), "trace_id") {
+		t.Errorf("Expected OpenMetrics only features to be left out:\n%s", printed.String())
+	}
+}
+
+func TestSeries_Escaping(t *testing.T) {
+	m := MetricData{Name: "x", Labels: map[string]string{"b": `say "hi"`, "a": "C:\\", "c": "line\nbreak"}}
+	expected := `x{a="C:\\",b="say \"hi\"",c="line\nbreak"}`
+	if got := m.Series(); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// Escaped series are valid exposition lines
+	families := parseText(t, m.Series()+" 1\n")
+	labels := metricLabels(families["x"].GetMetric()[0])
+	if labels["a"] != m.Labels["a"] || labels["b"] != m.Labels["b"] || labels["c"] != m.Labels["c"] {
+		t.Errorf("Expected labels %q after parsing %s, got %q", m.Labels, m.Series(), labels)
+	}
+}
+
+func TestWriteText_Precision(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, []MetricData{{Name: "big_counter_total", Type: "COUNTER", Value: 9007199254740991}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "# TYPE big_counter_total counter\nbig_counter_total 9.007199254740991e+15\n" {
+		t.Errorf("Expected the value with full precision, got %q", got)
+	}
+}
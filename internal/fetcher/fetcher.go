@@ -1,42 +1,77 @@
 package fetcher
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
-	"net/http"
+	"mime"
 	"slices"
-	"sort"
-	"strings"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// NullableFloat64 is a wrapper around float64 that marshals NaN as null in JSON
+// NullableFloat64 is a wrapper around float64 that marshals NaN as null in
+// JSON, and infinities as the strings "+Inf" and "-Inf", which JSON numbers
+// can't represent
 type NullableFloat64 float64
 
 // MarshalJSON implements the json.Marshaler interface
 func (nf NullableFloat64) MarshalJSON() ([]byte, error) {
-	if math.IsNaN(float64(nf)) {
+	switch {
+	case math.IsNaN(float64(nf)):
 		return []byte("null"), nil
+	case math.IsInf(float64(nf), 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(float64(nf), -1):
+		return []byte(`"-Inf"`), nil
 	}
 	return json.Marshal(float64(nf))
 }
 
+// UnmarshalJSON decodes null as NaN and "+Inf" and "-Inf" as infinities,
+// reversing MarshalJSON
+func (nf *NullableFloat64) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "null":
+		*nf = NullableFloat64(math.NaN())
+		return nil
+	case `"+Inf"`:
+		*nf = NullableFloat64(math.Inf(1))
+		return nil
+	case `"-Inf"`:
+		*nf = NullableFloat64(math.Inf(-1))
+		return nil
+	}
+	return json.Unmarshal(data, (*float64)(nf))
+}
+
 // MetricsFetcher handles fetching and filtering Prometheus metrics
 type MetricsFetcher struct {
-	url     string
-	metrics []string
-	labels  []string
-	client  *http.Client
+	url       string
+	filter    *Filter
+	transport transport
+	timeout   time.Duration // per-scrape timeout, or 0 for none
+	limits    Limits
+}
+
+// Exemplar is an example observation attached to a counter or histogram bucket
+type Exemplar struct {
+	Labels    map[string]string `json:"labels"`
+	Value     NullableFloat64   `json:"value"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
 }
 
 // HistogramBucket represents a histogram bucket with upper bound and cumulative count
 type HistogramBucket struct {
 	UpperBound      NullableFloat64 `json:"upper_bound"`
 	CumulativeCount uint64          `json:"cumulative_count"`
+	Exemplar        *Exemplar       `json:"exemplar,omitempty"`
 }
 
 // SummaryQuantile represents a summary quantile with quantile value and its value
@@ -50,11 +85,21 @@ type MetricData struct {
 	Name   string            `json:"name"`
 	Help   string            `json:"help,omitempty"`
 	Type   string            `json:"type,omitempty"`
+	Unit   string            `json:"unit,omitempty"`
 	Labels map[string]string `json:"labels"`
 
+	// Source is the URL the metric was scraped from
+	Source string `json:"source,omitempty"`
+
 	// For non-summary/histogram metrics:
 	Value NullableFloat64 `json:"value"`
 
+	// Counter:
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+
+	// Start time of counters, summaries and histograms, if exposed
+	Created *time.Time `json:"created,omitempty"`
+
 	// For Summary and Histograms:
 	SampleCount *uint64          `json:"sample_count,omitempty"`
 	SampleSum   *NullableFloat64 `json:"sample_sum,omitempty"`
@@ -62,276 +107,375 @@ type MetricData struct {
 	// Histogram:
 	Buckets []HistogramBucket `json:"buckets,omitempty"`
 
+	// Native histogram (only available through the protobuf format):
+	NativeHistogram *NativeHistogram `json:"native_histogram,omitempty"`
+
 	// Summary:
 	Quantiles []SummaryQuantile `json:"quantiles,omitempty"`
 }
 
-// Print writes the metric data to a buffer in Prometheus exposition format
-func (m MetricData) Print(buf *bytes.Buffer) {
-	switch strings.ToUpper(m.Type) {
-	case "HISTOGRAM":
-		m.printHistogram(buf)
-	case "SUMMARY":
-		m.printSummary(buf)
-	default:
-		// Handle simple metrics (counter, gauge, untyped)
-		m.printSimple(buf)
-	}
-}
-
-// Identifier is the metric name and labels
+// Identifier uniquely identifies a series: the metric name and labels,
+// followed by @ and the source URL if known
 func (m MetricData) Identifier() string {
-	r := strings.Builder{}
-	r.WriteString(m.Name)
-	if len(m.Labels) > 0 {
-		var labelPairs []string
-		for key, value := range m.Labels {
-			labelPairs = append(labelPairs, fmt.Sprintf(`%s="%s"`, key, value))
-		}
-		sort.Strings(labelPairs) // Sort for consistent output
-		r.WriteRune('{')
-		r.WriteString(strings.Join(labelPairs, ","))
-		r.WriteRune('}')
+	if m.Source == "" {
+		return m.Series()
 	}
-	return r.String()
+	return m.Series() + "@" + m.Source
 }
 
-// printSimple prints counter, gauge, and untyped metrics to buffer
-func (m MetricData) printSimple(buf *bytes.Buffer) {
-	fmt.Fprintf(buf, "%s %g\n", m.Identifier(), m.Value)
-}
-
-// printHistogram prints histogram metrics with buckets, sum, and count to buffer
-func (m MetricData) printHistogram(buf *bytes.Buffer) {
-	baseLabels := m.formatLabels(m.Labels)
-
-	// Print histogram buckets
-	for _, bucket := range m.Buckets {
-		bucketLabels := m.Labels
-		if bucketLabels == nil {
-			bucketLabels = make(map[string]string)
-		}
-		// Create a copy to avoid modifying the original
-		bucketLabelsCopy := make(map[string]string)
-		for k, v := range bucketLabels {
-			bucketLabelsCopy[k] = v
-		}
-		bucketLabelsCopy["le"] = fmt.Sprintf("%g", bucket.UpperBound)
-
-		bucketLabelsStr := m.formatLabels(bucketLabelsCopy)
-		if bucketLabelsStr != "" {
-			fmt.Fprintf(buf, "%s_bucket{%s} %d\n", m.Name, bucketLabelsStr, bucket.CumulativeCount)
-		} else {
-			fmt.Fprintf(buf, "%s_bucket{le=\"%g\"} %d\n", m.Name, bucket.UpperBound, bucket.CumulativeCount)
-		}
+// Series is the metric name and labels, without the source. Label values
+// are escaped as in the exposition formats.
+func (m MetricData) Series() string {
+	if len(m.Labels) == 0 {
+		return m.Name
 	}
+	return m.Name + "{" + formatLabelPairs(m.Labels) + "}"
+}
 
-	// Print histogram sum
-	if m.SampleSum != nil {
-		if baseLabels != "" {
-			fmt.Fprintf(buf, "%s_sum{%s} %g\n", m.Name, baseLabels, *m.SampleSum)
-		} else {
-			fmt.Fprintf(buf, "%s_sum %g\n", m.Name, *m.SampleSum)
-		}
+// nativeHistogramString formats a native histogram the way prometheus displays it
+func (m MetricData) nativeHistogramString() string {
+	s := fmt.Sprintf("%s {count:%d, sum:%s", m.Series(), m.sampleCount(), formatFloat(m.sampleSum()))
+	if buckets := m.NativeHistogram.String(); buckets != "" {
+		s += ", " + buckets
 	}
+	return s + "}"
+}
 
-	// Print histogram count
-	if m.SampleCount != nil {
-		if baseLabels != "" {
-			fmt.Fprintf(buf, "%s_count{%s} %d\n", m.Name, baseLabels, *m.SampleCount)
-		} else {
-			fmt.Fprintf(buf, "%s_count %d\n", m.Name, *m.SampleCount)
-		}
+// sampleCount returns the observation count, or 0 if it is not set
+func (m MetricData) sampleCount() uint64 {
+	if m.SampleCount == nil {
+		return 0
 	}
+	return *m.SampleCount
 }
 
-// printSummary prints summary metrics with quantiles, sum, and count to buffer
-func (m MetricData) printSummary(buf *bytes.Buffer) {
-	baseLabels := m.formatLabels(m.Labels)
-
-	// Print summary quantiles
-	for _, quantile := range m.Quantiles {
-		quantileLabels := m.Labels
-		if quantileLabels == nil {
-			quantileLabels = make(map[string]string)
-		}
-		// Create a copy to avoid modifying the original
-		quantileLabelsCopy := make(map[string]string)
-		for k, v := range quantileLabels {
-			quantileLabelsCopy[k] = v
-		}
-		quantileLabelsCopy["quantile"] = fmt.Sprintf("%g", quantile.Quantile)
-
-		quantileLabelsStr := m.formatLabels(quantileLabelsCopy)
-		if quantileLabelsStr != "" {
-			fmt.Fprintf(buf, "%s{%s} %g\n", m.Name, quantileLabelsStr, quantile.Value)
-		} else {
-			fmt.Fprintf(buf, "%s{quantile=\"%g\"} %g\n", m.Name, quantile.Quantile, quantile.Value)
-		}
+// sampleSum returns the observation sum, or 0 if it is not set
+func (m MetricData) sampleSum() float64 {
+	if m.SampleSum == nil {
+		return 0
 	}
+	return float64(*m.SampleSum)
+}
 
-	// Print summary sum
-	if m.SampleSum != nil {
-		if baseLabels != "" {
-			fmt.Fprintf(buf, "%s_sum{%s} %g\n", m.Name, baseLabels, *m.SampleSum)
-		} else {
-			fmt.Fprintf(buf, "%s_sum %g\n", m.Name, *m.SampleSum)
-		}
+// New creates a new MetricsFetcher with the specified URL, returning the
+// series selected by filter, or every series if filter is nil.
+// Besides HTTP URLs, the URL can be a unix socket, a glob of files or
+// standard input, as described by newTransport.
+func New(url string, filter *Filter) *MetricsFetcher {
+	return &MetricsFetcher{
+		url:       url,
+		filter:    filter,
+		transport: newTransport(url),
 	}
+}
 
-	// Print summary count
-	if m.SampleCount != nil {
-		if baseLabels != "" {
-			fmt.Fprintf(buf, "%s_count{%s} %d\n", m.Name, baseLabels, *m.SampleCount)
-		} else {
-			fmt.Fprintf(buf, "%s_count %d\n", m.Name, *m.SampleCount)
-		}
-	}
+// URL returns the endpoint this fetcher scrapes
+func (mf *MetricsFetcher) URL() string {
+	return mf.url
 }
 
-// formatLabels formats labels as {key="value",key2="value2"}
-func (m MetricData) formatLabels(labels map[string]string) string {
-	if len(labels) == 0 {
-		return ""
+// SetTimeout limits how long each scrape may take. The timeout is sent to
+// HTTP targets in the X-Prometheus-Scrape-Timeout-Seconds header, as
+// prometheus does, so that they can bound expensive collection. A timeout
+// of 0 means no limit.
+func (mf *MetricsFetcher) SetTimeout(timeout time.Duration) {
+	mf.timeout = timeout
+	if t, ok := mf.transport.(*httpTransport); ok {
+		t.timeout = timeout
 	}
+}
 
-	var labelPairs []string
-	for key, value := range labels {
-		labelPairs = append(labelPairs, fmt.Sprintf(`%s="%s"`, key, value))
-	}
-	sort.Strings(labelPairs) // Sort for consistent output
-	return strings.Join(labelPairs, ",")
+// Timeout returns the per-scrape timeout, or 0 if there is none
+func (mf *MetricsFetcher) Timeout() time.Duration {
+	return mf.timeout
 }
 
-// New creates a new MetricsFetcher with the specified URL, metrics, and labels
-func New(url string, metrics []string, labels []string) *MetricsFetcher {
-	return &MetricsFetcher{
-		url:     url,
-		metrics: metrics,
-		labels:  labels,
-		client:  &http.Client{},
-	}
+// SetLimits bounds the size of each scrape. A scrape exceeding a limit fails,
+// as it does in prometheus.
+func (mf *MetricsFetcher) SetLimits(limits Limits) {
+	mf.limits = limits
 }
 
-// Fetch retrieves metrics from the URL, parses them, and filters based on configured metrics and labels
+// Fetch retrieves metrics from the URL, parses them, and filters them with the configured Filter
 func (mf *MetricsFetcher) Fetch() ([]MetricData, error) {
-	// Fetch the metrics from the URL
-	resp, err := mf.client.Get(mf.url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch metrics from %s: %w", mf.url, err)
+	return mf.FetchContext(context.Background())
+}
+
+// FetchContext is like Fetch, but gives up when ctx is done or the scrape
+// timeout expires, whichever is first
+func (mf *MetricsFetcher) FetchContext(ctx context.Context) ([]MetricData, error) {
+	if mf.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mf.timeout)
+		defer cancel()
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received non-200 status code %d from %s", resp.StatusCode, mf.url)
+	expositions, err := mf.transport.open(ctx)
+	if err != nil {
+		return nil, mf.scrapeError(ctx, err)
 	}
+	defer closeExpositions(expositions)
 
-	// Parse the metrics using prometheus expfmt
-	parser := expfmt.TextParser{}
-	metricFamilies, err := parser.TextToMetricFamilies(resp.Body)
+	// Parse the metrics with the decoder matching each exposition's format,
+	// dropping unselected series as early as the format allows
+	metricFamilies, err := decodeExpositions(expositions, mf.filter, mf.limits)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+		return nil, mf.scrapeError(ctx, err)
 	}
 
 	// Filter and extract the metrics
 	var results []MetricData
 	for familyName, family := range metricFamilies {
-		// Skip if specific metrics are requested and this isn't one of them
-		if len(mf.metrics) > 0 && !slices.Contains(mf.metrics, familyName) {
+		// Skip whole families that no selector can match
+		if !mf.filter.MatchesName(familyName) {
 			continue
 		}
 
-		// Process each metric in the family
-		for _, metric := range family.GetMetric() {
-			labels := make(map[string]string)
-
-			// Extract labels from the metric
-			for _, labelPair := range metric.GetLabel() {
-				labels[labelPair.GetName()] = labelPair.GetValue()
+		for _, metricData := range convertFamily(family) {
+			if !mf.filter.Matches(metricData.Name, metricData.Labels) {
+				continue
 			}
+			metricData.Source = mf.url
+			results = append(results, metricData)
+		}
+	}
+
+	return results, nil
+}
+
+// scrapeError explains a failed scrape whose context is done, which
+// otherwise surfaces as an obscure transport or parsing error
+func (mf *MetricsFetcher) scrapeError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && mf.timeout > 0:
+		return fmt.Errorf("scrape of %s timed out after %s: %w", mf.url, mf.timeout, ctx.Err())
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("scrape of %s timed out: %w", mf.url, ctx.Err())
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("scrape of %s was cancelled: %w", mf.url, ctx.Err())
+	}
+	return err
+}
 
-			// Filter by labels if specified
-			if len(mf.labels) > 0 && !hasMatchingLabels(labels, mf.labels) {
+// decodeExpositions decodes every exposition of a scrape. Families spread
+// over several expositions, such as files written by different jobs, are merged.
+func decodeExpositions(expositions []exposition, filter *Filter, limits Limits) (map[string]*dto.MetricFamily, error) {
+	merged := make(map[string]*dto.MetricFamily)
+	samples := newSampleCounter(limits.Samples)
+	for _, e := range expositions {
+		families, err := decodeMetricFamilies(limitBody(e.body, limits.BodySize), e.contentType, filter, samples)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics from %s: %w", e.name, err)
+		}
+		for name, family := range families {
+			existing, ok := merged[name]
+			if !ok {
+				merged[name] = family
 				continue
 			}
+			if existing.GetType() != family.GetType() {
+				return nil, fmt.Errorf("metric %s is a %s in %s but a %s elsewhere", name, family.GetType(), e.name, existing.GetType())
+			}
+			existing.Metric = append(existing.Metric, family.Metric...)
+		}
+	}
+	return merged, nil
+}
 
-			// Get help and type information from the family
-			help := family.GetHelp()
-			metricType := family.GetType().String()
+// decodeMetricFamilies parses an exposition using the decoder matching its
+// Content-Type. Unknown or missing content types are parsed as the
+// prometheus text format, as prometheus itself does. Series not selected by
+// filter may be left out, and the samples kept are counted against the limit.
+func decodeMetricFamilies(r io.Reader, contentType string, filter *Filter, samples *sampleCounter) (map[string]*dto.MetricFamily, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
 
-			// Create base metric data
-			metricData := MetricData{
-				Name:   familyName,
-				Help:   help,
-				Type:   metricType,
-				Labels: labels,
+	switch mediaType {
+	case expfmt.ProtoType:
+		if params["proto"] != expfmt.ProtoProtocol || params["encoding"] != "delimited" {
+			return nil, fmt.Errorf("unsupported protobuf content type %q", contentType)
+		}
+		return decodeProtobuf(r, filter, samples)
+	case expfmt.OpenMetricsType:
+		return parseOpenMetrics(r, filter, samples)
+	default:
+		if filter != nil || samples != nil {
+			r = newTextFilter(r, filter, samples)
+		}
+		parser := expfmt.TextParser{}
+		return parser.TextToMetricFamilies(r)
+	}
+}
+
+// decodeProtobuf reads length-delimited protobuf metric families, one at a
+// time so that unselected families and series are dropped as they are read
+func decodeProtobuf(r io.Reader, filter *Filter, samples *sampleCounter) (map[string]*dto.MetricFamily, error) {
+	decoder := expfmt.NewDecoder(r, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	metricFamilies := make(map[string]*dto.MetricFamily)
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err != nil {
+			if errors.Is(err, io.EOF) {
+				return metricFamilies, nil
+			}
+			return nil, err
+		}
+		if !filter.MatchesName(family.GetName()) {
+			continue
+		}
+		if filter.usesLabels() {
+			family.Metric = slices.DeleteFunc(family.Metric, func(m *dto.Metric) bool {
+				return !filter.Matches(family.GetName(), metricLabels(m))
+			})
+		}
+		for _, m := range family.Metric {
+			if err := samples.add(metricSamples(family.GetType(), m)); err != nil {
+				return nil, err
 			}
+		}
+		if existing, ok := metricFamilies[family.GetName()]; ok {
+			existing.Metric = append(existing.Metric, family.Metric...)
+		} else {
+			metricFamilies[family.GetName()] = family
+		}
+	}
+}
 
-			// Extract the value and additional data based on metric type
-			switch family.GetType() {
-			case dto.MetricType_COUNTER:
-				if metric.Counter != nil {
-					metricData.Value = NullableFloat64(metric.Counter.GetValue())
-				}
-			case dto.MetricType_GAUGE:
-				if metric.Gauge != nil {
-					metricData.Value = NullableFloat64(metric.Gauge.GetValue())
+// convertFamily extracts every metric in a family into MetricData
+func convertFamily(family *dto.MetricFamily) []MetricData {
+	var results []MetricData
+
+	// Get help, type and unit information from the family
+	familyName := family.GetName()
+	help := family.GetHelp()
+	metricType := family.GetType().String()
+	unit := family.GetUnit()
+
+	// Process each metric in the family
+	for _, metric := range family.GetMetric() {
+		labels := metricLabels(metric)
+
+		// Create base metric data
+		metricData := MetricData{
+			Name:   familyName,
+			Help:   help,
+			Type:   metricType,
+			Unit:   unit,
+			Labels: labels,
+		}
+
+		// Extract the value and additional data based on metric type
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			if metric.Counter != nil {
+				metricData.Value = NullableFloat64(metric.Counter.GetValue())
+				metricData.Created = timestampToTime(metric.Counter.GetCreatedTimestamp())
+				metricData.Exemplar = convertExemplar(metric.Counter.GetExemplar())
+			}
+		case dto.MetricType_GAUGE:
+			if metric.Gauge != nil {
+				metricData.Value = NullableFloat64(metric.Gauge.GetValue())
+			}
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			if metric.Histogram != nil {
+				sampleCount := metric.Histogram.GetSampleCount()
+				if countFloat := metric.Histogram.GetSampleCountFloat(); countFloat > 0 {
+					sampleCount = uint64(math.Round(countFloat))
 				}
-			case dto.MetricType_HISTOGRAM:
-				if metric.Histogram != nil {
-					sampleCount := metric.Histogram.GetSampleCount()
-					sampleSum := NullableFloat64(metric.Histogram.GetSampleSum())
-					metricData.SampleCount = &sampleCount
-					metricData.SampleSum = &sampleSum
-
-					// Extract buckets
-					for _, bucket := range metric.Histogram.GetBucket() {
-						metricData.Buckets = append(metricData.Buckets, HistogramBucket{
-							UpperBound:      NullableFloat64(bucket.GetUpperBound()),
-							CumulativeCount: bucket.GetCumulativeCount(),
-						})
-					}
+				sampleSum := NullableFloat64(metric.Histogram.GetSampleSum())
+				metricData.SampleCount = &sampleCount
+				metricData.SampleSum = &sampleSum
+				metricData.Created = timestampToTime(metric.Histogram.GetCreatedTimestamp())
+
+				// Extract buckets
+				for _, bucket := range metric.Histogram.GetBucket() {
+					metricData.Buckets = append(metricData.Buckets, HistogramBucket{
+						UpperBound:      NullableFloat64(bucket.GetUpperBound()),
+						CumulativeCount: bucket.GetCumulativeCount(),
+						Exemplar:        convertExemplar(bucket.GetExemplar()),
+					})
 				}
-			case dto.MetricType_SUMMARY:
-				if metric.Summary != nil {
-					sampleCount := metric.Summary.GetSampleCount()
-					sampleSum := NullableFloat64(metric.Summary.GetSampleSum())
-					metricData.SampleCount = &sampleCount
-					metricData.SampleSum = &sampleSum
-
-					for _, quantile := range metric.Summary.GetQuantile() {
-						metricData.Quantiles = append(metricData.Quantiles, SummaryQuantile{
-							Quantile: NullableFloat64(quantile.GetQuantile()),
-							Value:    NullableFloat64(quantile.GetValue()),
-						})
-					}
+
+				if isNativeHistogram(metric.Histogram) {
+					metricData.NativeHistogram = convertNativeHistogram(metric.Histogram)
 				}
-			case dto.MetricType_UNTYPED:
-				if metric.Untyped != nil {
-					metricData.Value = NullableFloat64(metric.Untyped.GetValue())
+			}
+		case dto.MetricType_SUMMARY:
+			if metric.Summary != nil {
+				sampleCount := metric.Summary.GetSampleCount()
+				sampleSum := NullableFloat64(metric.Summary.GetSampleSum())
+				metricData.SampleCount = &sampleCount
+				metricData.SampleSum = &sampleSum
+				metricData.Created = timestampToTime(metric.Summary.GetCreatedTimestamp())
+
+				for _, quantile := range metric.Summary.GetQuantile() {
+					metricData.Quantiles = append(metricData.Quantiles, SummaryQuantile{
+						Quantile: NullableFloat64(quantile.GetQuantile()),
+						Value:    NullableFloat64(quantile.GetValue()),
+					})
 				}
 			}
-
-			results = append(results, metricData)
+		case dto.MetricType_UNTYPED:
+			if metric.Untyped != nil {
+				metricData.Value = NullableFloat64(metric.Untyped.GetValue())
+			}
 		}
+
+		results = append(results, metricData)
 	}
 
-	return results, nil
+	return results
 }
 
-// hasMatchingLabels checks if the metric labels contain any of the requested labels
-func hasMatchingLabels(metricLabels map[string]string, requestedLabels []string) bool {
-	for _, requestedLabel := range requestedLabels {
-		// Check if the requested label exists as a key in the metric labels
-		if _, exists := metricLabels[requestedLabel]; exists {
-			return true
-		}
-		// Also check if the requested label matches any key=value pair
-		for key, value := range metricLabels {
-			if requestedLabel == key || requestedLabel == fmt.Sprintf("%s=%s", key, value) {
-				return true
-			}
-		}
+// metricLabels extracts the labels of a metric
+func metricLabels(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, labelPair := range metric.GetLabel() {
+		labels[labelPair.GetName()] = labelPair.GetValue()
+	}
+	return labels
+}
+
+// metricSamples is the number of samples a metric has in the text format,
+// which is what the sample limit counts
+func metricSamples(metricType dto.MetricType, metric *dto.Metric) int {
+	switch metricType {
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return len(metric.GetHistogram().GetBucket()) + 2
+	case dto.MetricType_SUMMARY:
+		return len(metric.GetSummary().GetQuantile()) + 2
+	}
+	return 1
+}
+
+// timestampToTime converts an optional protobuf timestamp
+func timestampToTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
 	}
-	return false
+	t := ts.AsTime()
+	return &t
+}
+
+// convertExemplar converts an optional exemplar
+func convertExemplar(e *dto.Exemplar) *Exemplar {
+	if e == nil {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, labelPair := range e.GetLabel() {
+		labels[labelPair.GetName()] = labelPair.GetValue()
+	}
+	return &Exemplar{
+		Labels:    labels,
+		Value:     NullableFloat64(e.GetValue()),
+		Timestamp: timestampToTime(e.GetTimestamp()),
+	}
+}
+
+// Matches reports whether the metric passes the same filter that Fetch applies
+func (m MetricData) Matches(filter *Filter) bool {
+	return filter.Matches(m.Name, m.Labels)
 }
@@ -2,11 +2,18 @@ package fetcher
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
 )
 
 // Mock Prometheus metrics data in the standard exposition format
@@ -63,7 +70,7 @@ func TestFetcherWithHttpTest(t *testing.T) {
 	defer server.Close()
 
 	// Create a fetcher pointing to our test server
-	fetcher := New(server.URL, nil, nil)
+	fetcher := New(server.URL, nil)
 
 	// Fetch the metrics
 	metrics, err := fetcher.Fetch()
@@ -78,8 +85,8 @@ func TestFetcherWithHttpTest(t *testing.T) {
 
 	// Print the fetched metrics to a buffer and compare with expected output
 	var buf bytes.Buffer
-	for _, metric := range metrics {
-		metric.Print(&buf)
+	if err := WriteText(&buf, metrics); err != nil {
+		t.Fatal(err)
 	}
 	output := buf.String()
 
@@ -108,7 +115,7 @@ func TestFilterSpecificMetric(t *testing.T) {
 	server := testServer()
 	defer server.Close()
 	// Test specific metric filtering
-	filteredMetrics, err := New(server.URL, []string{"process_cpu_seconds_total"}, nil).Fetch()
+	filteredMetrics, err := New(server.URL, mustFilter(t, []string{"process_cpu_seconds_total"}, nil)).Fetch()
 	if err != nil {
 		t.Fatalf("Failed to fetch filtered metrics: %v", err)
 	}
@@ -122,11 +129,30 @@ func TestFilterSpecificMetric(t *testing.T) {
 	}
 }
 
+func TestIdentifierIncludesSource(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	metrics, err := New(server.URL, mustFilter(t, []string{"process_cpu_seconds_total"}, nil)).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+
+	if metrics[0].Source != server.URL {
+		t.Errorf("Expected source %q, got %q", server.URL, metrics[0].Source)
+	}
+	if got := metrics[0].Identifier(); got != "process_cpu_seconds_total@"+server.URL {
+		t.Errorf("Unexpected identifier %q", got)
+	}
+	if got := metrics[0].Series(); got != "process_cpu_seconds_total" {
+		t.Errorf("Unexpected series %q", got)
+	}
+}
+
 func TestFilterByLabel(t *testing.T) {
 	server := testServer()
 	defer server.Close()
 
-	labelMetrics, err := New(server.URL, nil, []string{"method"}).Fetch()
+	labelMetrics, err := New(server.URL, mustFilter(t, nil, []string{"method"})).Fetch()
 	if err != nil {
 		t.Fatalf("Failed to fetch label-filtered metrics: %v", err)
 	}
@@ -147,7 +173,7 @@ func TestFilterByLabelAndValue(t *testing.T) {
 	server := testServer()
 	defer server.Close()
 
-	labelMetrics, err := New(server.URL, nil, []string{"method=post"}).Fetch()
+	labelMetrics, err := New(server.URL, mustFilter(t, nil, []string{"method=post"})).Fetch()
 	if err != nil {
 		t.Fatalf("Failed to fetch label-filtered metrics: %v", err)
 	}
@@ -162,3 +188,205 @@ func TestFilterByLabelAndValue(t *testing.T) {
 		t.Errorf("Expected 2 label-filtered metric, got %d", len(labelMetrics))
 	}
 }
+
+func TestFetchSendsAcceptHeader(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL, nil).Fetch(); err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+
+	for _, format := range []string{"application/vnd.google.protobuf", "application/openmetrics-text", "text/plain"} {
+		if !strings.Contains(accept, format) {
+			t.Errorf("Expected Accept header to offer %s, got %q", format, accept)
+		}
+	}
+}
+
+func TestFetchSendsScrapeTimeout(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	defer server.Close()
+
+	f := New(server.URL, nil)
+	if _, err := f.Fetch(); err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if header != "" {
+		t.Errorf("Expected no timeout header without a timeout, got %q", header)
+	}
+
+	f.SetTimeout(2500 * time.Millisecond)
+	if _, err := f.Fetch(); err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if header != "2.5" {
+		t.Errorf("Expected timeout header 2.5, got %q", header)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	f := New(server.URL, nil)
+	f.SetTimeout(50 * time.Millisecond)
+	_, err := f.Fetch()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline exceeded error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("Expected the error to say the scrape timed out, got %q", err)
+	}
+}
+
+func TestFetchContextCancelled(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := New(server.URL, nil).FetchContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a cancelled error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "was cancelled") {
+		t.Errorf("Expected the error to say the scrape was cancelled, got %q", err)
+	}
+}
+
+func TestFetchOpenMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		fmt.Fprint(w, mockOpenMetricsData)
+	}))
+	defer server.Close()
+
+	metrics, err := New(server.URL, mustFilter(t, []string{"http_requests_total"}, []string{"method=post"})).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %d", len(metrics))
+	}
+
+	metric := metrics[0]
+	if metric.Value != 1027 || metric.Unit != "requests" {
+		t.Errorf("Unexpected metric %+v", metric)
+	}
+	if metric.Created == nil || metric.Created.Unix() != 1700000000 {
+		t.Errorf("Expected created timestamp, got %v", metric.Created)
+	}
+	if metric.Exemplar == nil || metric.Exemplar.Labels["trace_id"] != "abc123" {
+		t.Errorf("Expected exemplar, got %+v", metric.Exemplar)
+	}
+}
+
+func TestFetchProtobuf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+		w.Header().Set("Content-Type", string(format))
+
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(strings.NewReader(mockMetricsData))
+		if err != nil {
+			t.Errorf("Failed to parse mock metrics: %v", err)
+			return
+		}
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				t.Errorf("Failed to encode %s: %v", family.GetName(), err)
+			}
+		}
+	}))
+	defer server.Close()
+
+	metrics, err := New(server.URL, nil).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, expectedLine := range []string{
+		"http_requests_total{code=\"200\",method=\"post\"} 1027",
+		"http_request_duration_seconds_bucket{le=\"0.1\"} 24054",
+		"rpc_duration_seconds{quantile=\"0.01\"} 3102",
+	} {
+		if !strings.Contains(buf.String(), expectedLine) {
+			t.Errorf("Expected output to contain: %s\nActual output:\n%s", expectedLine, buf.String())
+		}
+	}
+}
+
+func TestFetchUnsupportedProtobufEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=text")
+		fmt.Fprint(w, "garbage")
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL, nil).Fetch(); err == nil {
+		t.Error("Expected an error for an unsupported protobuf encoding")
+	}
+}
+
+func TestNullableFloat64JSON(t *testing.T) {
+	values := []NullableFloat64{1.5, NullableFloat64(math.NaN()), NullableFloat64(math.Inf(1)), NullableFloat64(math.Inf(-1))}
+	data, err := json.Marshal(values)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if string(data) != `[1.5,null,"+Inf","-Inf"]` {
+		t.Errorf("expected NaN to marshal as null and infinities as strings, got %s", data)
+	}
+
+	var decoded []NullableFloat64
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if decoded[0] != 1.5 || !math.IsNaN(float64(decoded[1])) || !math.IsInf(float64(decoded[2]), 1) || !math.IsInf(float64(decoded[3]), -1) {
+		t.Errorf("expected [1.5 NaN +Inf -Inf], got %v", decoded)
+	}
+}
+
+func TestMetricDataJSON_Histogram(t *testing.T) {
+	count, sum := uint64(9), NullableFloat64(0.5)
+	metric := MetricData{Name: "latency_seconds", Type: "HISTOGRAM", SampleCount: &count, SampleSum: &sum,
+		Buckets: []HistogramBucket{{UpperBound: 0.1, CumulativeCount: 7}, {UpperBound: NullableFloat64(math.Inf(1)), CumulativeCount: 9}}}
+	data, err := json.Marshal(metric)
+	if err != nil {
+		t.Fatalf("failed to marshal a histogram: %v", err)
+	}
+	if !strings.Contains(string(data), `{"upper_bound":"+Inf","cumulative_count":9}`) {
+		t.Errorf("expected the +Inf bucket, got %s", data)
+	}
+
+	var decoded MetricData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if len(decoded.Buckets) != 2 || !math.IsInf(float64(decoded.Buckets[1].UpperBound), 1) {
+		t.Errorf("expected the +Inf bucket to round trip, got %+v", decoded.Buckets)
+	}
+}
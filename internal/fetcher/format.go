@@ -0,0 +1,293 @@
+package fetcher
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Formats lists the formats NewEncoder supports
+var Formats = []string{"text", "openmetrics", "csv", "tsv", "influx"}
+
+// Encoder writes scraped metrics in one of the output formats. Each call to
+// Encode writes one round of scrapes, of one or more targets, taken at t.
+type Encoder interface {
+	Encode(t time.Time, metrics []MetricData) error
+}
+
+// NewEncoder returns an encoder writing the named format to w
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case "text":
+		return expositionEncoder{w: w, write: WriteText}, nil
+	case "openmetrics":
+		return openMetricsEncoder{w: w}, nil
+	case "csv":
+		return newTableEncoder(w, ','), nil
+	case "tsv":
+		return newTableEncoder(w, '\t'), nil
+	case "influx":
+		return influxEncoder{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Sample is a single sample as the text format shows it. Histograms and
+// summaries flatten into a sample per bucket or quantile, plus _sum and _count.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Samples flattens the metric into its samples
+func (m MetricData) Samples() []Sample {
+	var samples []Sample
+	sample := func(suffix, extraLabel, extraValue string, value float64) {
+		labels := m.Labels
+		if extraLabel != "" {
+			// Copy to avoid modifying the original
+			labels = maps.Clone(m.Labels)
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[extraLabel] = extraValue
+		}
+		samples = append(samples, Sample{Name: m.Name + suffix, Labels: labels, Value: value})
+	}
+	sumAndCount := func() {
+		if m.SampleSum != nil {
+			sample("_sum", "", "", float64(*m.SampleSum))
+		}
+		if m.SampleCount != nil {
+			sample("_count", "", "", float64(*m.SampleCount))
+		}
+	}
+
+	switch strings.ToUpper(m.Type) {
+	case "HISTOGRAM", "GAUGE_HISTOGRAM":
+		for _, bucket := range m.Buckets {
+			sample("_bucket", "le", formatFloat(float64(bucket.UpperBound)), float64(bucket.CumulativeCount))
+		}
+		sumAndCount()
+	case "SUMMARY":
+		for _, quantile := range m.Quantiles {
+			sample("", "quantile", formatFloat(float64(quantile.Quantile)), float64(quantile.Value))
+		}
+		sumAndCount()
+	default:
+		sample("", "", "", float64(m.Value))
+	}
+	return samples
+}
+
+// expositionEncoder writes a text format exposition per target, in the
+// order the targets first appear in the metrics
+type expositionEncoder struct {
+	w     io.Writer
+	write func(io.Writer, []MetricData) error
+}
+
+func (e expositionEncoder) Encode(_ time.Time, metrics []MetricData) error {
+	var sources []string
+	bySource := make(map[string][]MetricData)
+	for _, m := range metrics {
+		if _, ok := bySource[m.Source]; !ok {
+			sources = append(sources, m.Source)
+		}
+		bySource[m.Source] = append(bySource[m.Source], m)
+	}
+	for i, source := range sources {
+		if i > 0 {
+			if _, err := io.WriteString(e.w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := e.write(e.w, bySource[source]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openMetricsEncoder writes each round of scrapes as a single OpenMetrics
+// exposition, as it can only end with one # EOF. Series of every target are
+// merged into their families and told apart by a target label.
+type openMetricsEncoder struct {
+	w io.Writer
+}
+
+func (e openMetricsEncoder) Encode(_ time.Time, metrics []MetricData) error {
+	labeled := make([]MetricData, len(metrics))
+	for i, m := range metrics {
+		if m.Source != "" {
+			m.Labels = withTarget(m.Labels, m.Source)
+		}
+		labeled[i] = m
+	}
+	return WriteOpenMetrics(e.w, labeled)
+}
+
+// withTarget returns a copy of labels with a target label added, renaming a
+// clashing label to exported_target as prometheus does
+func withTarget(labels map[string]string, target string) map[string]string {
+	labels = maps.Clone(labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if exported, ok := labels["target"]; ok {
+		labels["exported_target"] = exported
+	}
+	labels["target"] = target
+	return labels
+}
+
+// WriteOpenMetrics writes metrics in the OpenMetrics text format, with
+// units, exemplars and created timestamps, followed by # EOF. Gauge
+// histograms are written as histograms, and native histogram buckets, which
+// OpenMetrics can't carry, are left out.
+func WriteOpenMetrics(w io.Writer, metrics []MetricData) error {
+	for _, family := range Families(metrics) {
+		if family.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+			family.Type = dto.MetricType_HISTOGRAM.Enum()
+		}
+		if _, err := expfmt.MetricFamilyToOpenMetrics(w, family, expfmt.WithUnit(), expfmt.WithCreatedLines()); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", family.GetName(), err)
+		}
+	}
+	_, err := expfmt.FinalizeOpenMetrics(w)
+	return err
+}
+
+// tableColumns are the columns of CSV and TSV output besides the labels
+var tableColumns = []string{"timestamp", "target", "metric", "value"}
+
+// tableEncoder writes CSV or TSV with a row per sample: the scrape time,
+// target, metric name, a column per label name and the value. The label
+// columns are fixed by the first samples encoded, so that the output has a
+// single header, and label names first seen later are left out.
+type tableEncoder struct {
+	w      *csv.Writer
+	labels []string // label columns, sorted
+	header bool     // whether the header has been written
+}
+
+func newTableEncoder(w io.Writer, comma rune) *tableEncoder {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	return &tableEncoder{w: writer}
+}
+
+func (e *tableEncoder) Encode(t time.Time, metrics []MetricData) error {
+	var samples []Sample
+	var sources []string
+	for _, m := range metrics {
+		for _, s := range m.Samples() {
+			samples = append(samples, s)
+			sources = append(sources, m.Source)
+		}
+	}
+
+	if !e.header {
+		if len(samples) == 0 {
+			// Wait for samples to find the label columns
+			return nil
+		}
+		e.labels = labelNames(samples)
+		header := []string{"timestamp", "target", "metric"}
+		for _, label := range e.labels {
+			if slices.Contains(tableColumns, label) {
+				// Rename labels clashing with a column, as prometheus does
+				label = "exported_" + label
+			}
+			header = append(header, label)
+		}
+		if err := e.w.Write(append(header, "value")); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	timestamp := t.UTC().Format(time.RFC3339Nano)
+	for i, s := range samples {
+		row := []string{timestamp, sources[i], s.Name}
+		for _, label := range e.labels {
+			row = append(row, s.Labels[label])
+		}
+		if err := e.w.Write(append(row, formatFloat(s.Value))); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// labelNames returns the label names of the samples, sorted
+func labelNames(samples []Sample) []string {
+	var names []string
+	for _, s := range samples {
+		for name := range s.Labels {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	// influxNameEscaper escapes measurement names in the line protocol.
+	// Newlines can't be escaped, as they end a line, so they are removed.
+	influxNameEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "")
+	// influxTagEscaper escapes tag keys and values in the line protocol,
+	// removing newlines
+	influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "")
+)
+
+// influxEncoder writes the InfluxDB line protocol, with a line per sample
+// whose measurement is the sample name, whose tags are its labels plus the
+// target, and whose only field is value. Empty labels are left out, as the
+// line protocol has no empty tags, and so are NaN and infinite values,
+// which InfluxDB rejects.
+type influxEncoder struct {
+	w io.Writer
+}
+
+func (e influxEncoder) Encode(t time.Time, metrics []MetricData) error {
+	var buf bytes.Buffer
+	timestamp := strconv.FormatInt(t.UnixNano(), 10)
+	for _, m := range metrics {
+		for _, s := range m.Samples() {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			tags := s.Labels
+			if m.Source != "" {
+				tags = withTarget(s.Labels, m.Source)
+			}
+
+			buf.WriteString(influxNameEscaper.Replace(s.Name))
+			for _, name := range slices.Sorted(maps.Keys(tags)) {
+				if tags[name] == "" {
+					continue
+				}
+				buf.WriteString("," + influxTagEscaper.Replace(name) + "=" + influxTagEscaper.Replace(tags[name]))
+			}
+			buf.WriteString(" value=" + strconv.FormatFloat(s.Value, 'g', -1, 64) + " " + timestamp + "\n")
+		}
+	}
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,182 @@
+package fetcher
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// formatTestData has a counter, a summary and a histogram from two targets
+func formatTestData() []MetricData {
+	count, sum := uint64(9), NullableFloat64(0.5)
+	return []MetricData{
+		{Name: "http_requests_total", Type: "COUNTER", Labels: map[string]string{"code": "200", "path": "/a,b c"}, Value: 3, Source: "http://a/metrics"},
+		{Name: "rpc_seconds", Type: "SUMMARY", Labels: map[string]string{"service": "x"}, SampleCount: &count, SampleSum: &sum,
+			Quantiles: []SummaryQuantile{{Quantile: 0.99, Value: NullableFloat64(math.NaN())}}, Source: "http://a/metrics"},
+		{Name: "latency_seconds", Type: "HISTOGRAM", SampleCount: &count, SampleSum: &sum,
+			Buckets: []HistogramBucket{{UpperBound: 0.1, CumulativeCount: 7}, {UpperBound: NullableFloat64(math.Inf(1)), CumulativeCount: 9}}, Source: "http://b/metrics"},
+	}
+}
+
+func TestSamples(t *testing.T) {
+	var samples []string
+	for _, m := range formatTestData() {
+		for _, s := range m.Samples() {
+			samples = append(samples, fmt.Sprintf("%s %s", MetricData{Name: s.Name, Labels: s.Labels}.Series(), formatFloat(s.Value)))
+		}
+	}
+	expected := []string{
+		`http_requests_total{code="200",path="/a,b c"} 3`,
+		`rpc_seconds{quantile="0.99",service="x"} NaN`,
+		`rpc_seconds_sum{service="x"} 0.5`,
+		`rpc_seconds_count{service="x"} 9`,
+		`latency_seconds_bucket{le="0.1"} 7`,
+		`latency_seconds_bucket{le="+Inf"} 9`,
+		`latency_seconds_sum 0.5`,
+		`latency_seconds_count 9`,
+	}
+	if strings.Join(samples, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected samples:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(samples, "\n"))
+	}
+}
+
+func encode(t *testing.T, format string, rounds ...[]MetricData) string {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, metrics := range rounds {
+		if err := encoder.Encode(at.Add(time.Duration(i)*time.Second), metrics); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestEncode_CSV(t *testing.T) {
+	expected := `timestamp,target,metric,code,le,path,quantile,service,value
+2024-01-02T03:04:05Z,http://a/metrics,http_requests_total,200,,"/a,b c",,,3
+2024-01-02T03:04:05Z,http://a/metrics,rpc_seconds,,,,0.99,x,NaN
+2024-01-02T03:04:05Z,http://a/metrics,rpc_seconds_sum,,,,,x,0.5
+2024-01-02T03:04:05Z,http://a/metrics,rpc_seconds_count,,,,,x,9
+2024-01-02T03:04:05Z,http://b/metrics,latency_seconds_bucket,,0.1,,,,7
+2024-01-02T03:04:05Z,http://b/metrics,latency_seconds_bucket,,+Inf,,,,9
+2024-01-02T03:04:05Z,http://b/metrics,latency_seconds_sum,,,,,,0.5
+2024-01-02T03:04:05Z,http://b/metrics,latency_seconds_count,,,,,,9
+`
+	if got := encode(t, "csv", formatTestData()); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestEncode_TSVFixedColumns(t *testing.T) {
+	first := []MetricData{{Name: "up", Value: 0}, {Name: "jobs", Labels: map[string]string{"value": "a", "queue": "q"}, Value: 2}}
+	second := []MetricData{{Name: "up", Value: 1}, {Name: "jobs", Labels: map[string]string{"host": "h"}, Value: 3}}
+
+	// The columns are fixed by the first samples, so the header is written
+	// once, and labels clashing with a column are renamed
+	expected := "timestamp\ttarget\tmetric\tqueue\texported_value\tvalue\n" +
+		"2024-01-02T03:04:06Z\t\tup\t\t\t0\n" +
+		"2024-01-02T03:04:06Z\t\tjobs\tq\ta\t2\n" +
+		"2024-01-02T03:04:07Z\t\tup\t\t\t1\n" +
+		"2024-01-02T03:04:07Z\t\tjobs\t\t\t3\n"
+	if got := encode(t, "tsv", nil, first, second); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestEncode_Influx(t *testing.T) {
+	metrics := append(formatTestData(), MetricData{Name: "jobs", Labels: map[string]string{"target": "t", "empty": "", "queue": "a\nb"}, Value: 1e21})
+	expected := `http_requests_total,code=200,path=/a\,b\ c,target=http://a/metrics value=3 1704164645000000000
+rpc_seconds_sum,service=x,target=http://a/metrics value=0.5 1704164645000000000
+rpc_seconds_count,service=x,target=http://a/metrics value=9 1704164645000000000
+latency_seconds_bucket,le=0.1,target=http://b/metrics value=7 1704164645000000000
+latency_seconds_bucket,le=+Inf,target=http://b/metrics value=9 1704164645000000000
+latency_seconds_sum,target=http://b/metrics value=0.5 1704164645000000000
+latency_seconds_count,target=http://b/metrics value=9 1704164645000000000
+jobs,queue=ab,target=t value=1e+21 1704164645000000000
+`
+	if got := encode(t, "influx", metrics); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestEncode_OpenMetrics(t *testing.T) {
+	original, err := parseOpenMetrics(strings.NewReader(mockOpenMetricsData), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := encode(t, "openmetrics", convertAll(original))
+	if !strings.HasSuffix(output, "# EOF\n") || strings.Count(output, "# EOF") != 1 {
+		t.Errorf("Expected a single # EOF at the end:\n%s", output)
+	}
+
+	// Units and exemplars survive, unlike in the text format
+	reparsed, err := parseOpenMetrics(strings.NewReader(output), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse:\n%s\n%v", output, err)
+	}
+	// Gauge histograms become histograms, and sample timestamps aren't kept
+	for _, family := range original {
+		if family.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+			family.Type = dto.MetricType_HISTOGRAM.Enum()
+		}
+		for _, metric := range family.Metric {
+			metric.TimestampMs = nil
+		}
+	}
+	if want, got := canonicalText(t, original), canonicalText(t, reparsed); want != got {
+		t.Errorf("Families changed in a round trip.\nOriginal:\n%s\nAfter encoding:\n%s", want, got)
+	}
+	if !strings.Contains(output, "# UNIT") || !strings.Contains(output, "trace_id") {
+		t.Errorf("Expected units and exemplars in:\n%s", output)
+	}
+}
+
+func TestEncode_OpenMetricsTargets(t *testing.T) {
+	metrics := append(formatTestData(),
+		MetricData{Name: "http_requests_total", Type: "COUNTER", Labels: map[string]string{"code": "200", "target": "t"}, Value: 4, Source: "http://b/metrics"})
+	output := encode(t, "openmetrics", metrics)
+	// Every target is merged into one exposition
+	if strings.Count(output, "# EOF") != 1 || strings.Count(output, "# TYPE http_requests counter") != 1 {
+		t.Errorf("Expected a single exposition:\n%s", output)
+	}
+
+	families, err := parseOpenMetrics(strings.NewReader(output), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse:\n%s\n%v", output, err)
+	}
+	var series []string
+	for _, m := range convertAll(families) {
+		if m.Name == "http_requests_total" {
+			series = append(series, m.Series())
+		}
+	}
+	expected := []string{
+		`http_requests_total{code="200",exported_target="t",target="http://b/metrics"}`,
+		`http_requests_total{code="200",path="/a,b c",target="http://a/metrics"}`,
+	}
+	if strings.Join(series, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected series:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(series, "\n"))
+	}
+}
+
+func TestEncode_TextPerTarget(t *testing.T) {
+	output := encode(t, "text", formatTestData())
+	// Each target gets its own exposition
+	if strings.Count(output, "# TYPE") != 3 || !strings.Contains(output, "\n\n# TYPE latency_seconds histogram\n") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+
+	if _, err := NewEncoder(&bytes.Buffer{}, "xml"); err == nil || !strings.Contains(err.Error(), "csv") {
+		t.Errorf("Expected an error listing the formats, got %v", err)
+	}
+}
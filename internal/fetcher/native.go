@@ -0,0 +1,305 @@
+package fetcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// BucketSpan is a run of consecutive native histogram buckets. The first
+// span's offset is the index of its first bucket; later offsets are the gap
+// after the end of the previous span.
+type BucketSpan struct {
+	Offset int32  `json:"offset"`
+	Length uint32 `json:"length"`
+}
+
+// NativeHistogram is a native (sparse) histogram with exponential buckets.
+// Bucket counts are absolute counts per bucket, not deltas or cumulative.
+type NativeHistogram struct {
+	Schema          int32        `json:"schema"`
+	ZeroThreshold   float64      `json:"zero_threshold"`
+	ZeroCount       float64      `json:"zero_count"`
+	PositiveSpans   []BucketSpan `json:"positive_spans,omitempty"`
+	PositiveBuckets []float64    `json:"positive_buckets,omitempty"`
+	NegativeSpans   []BucketSpan `json:"negative_spans,omitempty"`
+	NegativeBuckets []float64    `json:"negative_buckets,omitempty"`
+}
+
+// NativeBucket is a single native histogram bucket with its boundaries
+type NativeBucket struct {
+	Lower float64
+	Upper float64
+	Count float64
+}
+
+// isNativeHistogram reports whether a histogram carries native buckets.
+// Exporters send a no-op span for native histograms without observations,
+// so they can be told apart from classic ones.
+func isNativeHistogram(h *dto.Histogram) bool {
+	return len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0 ||
+		h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0
+}
+
+// convertNativeHistogram extracts the native part of a histogram
+func convertNativeHistogram(h *dto.Histogram) *NativeHistogram {
+	n := &NativeHistogram{
+		Schema:          h.GetSchema(),
+		ZeroThreshold:   h.GetZeroThreshold(),
+		ZeroCount:       float64(h.GetZeroCount()),
+		PositiveSpans:   convertSpans(h.GetPositiveSpan()),
+		PositiveBuckets: absoluteCounts(h.GetPositiveDelta(), h.GetPositiveCount()),
+		NegativeSpans:   convertSpans(h.GetNegativeSpan()),
+		NegativeBuckets: absoluteCounts(h.GetNegativeDelta(), h.GetNegativeCount()),
+	}
+	if h.GetZeroCountFloat() > 0 {
+		n.ZeroCount = h.GetZeroCountFloat()
+	}
+	return n
+}
+
+func convertSpans(spans []*dto.BucketSpan) []BucketSpan {
+	var result []BucketSpan
+	for _, span := range spans {
+		result = append(result, BucketSpan{Offset: span.GetOffset(), Length: span.GetLength()})
+	}
+	return result
+}
+
+// absoluteCounts resolves integer bucket deltas, or copies float counts
+func absoluteCounts(deltas []int64, counts []float64) []float64 {
+	if len(counts) > 0 {
+		return append([]float64(nil), counts...)
+	}
+	var result []float64
+	var current int64
+	for _, delta := range deltas {
+		current += delta
+		result = append(result, float64(current))
+	}
+	return result
+}
+
+// bucketUpperBound returns the upper bound of the positive bucket at index
+// idx. Each bucket boundary is the previous one times 2^(2^-schema).
+func bucketUpperBound(schema int32, idx int) float64 {
+	return math.Exp2(float64(idx) * math.Exp2(-float64(schema)))
+}
+
+// Count returns the total number of observations in the histogram
+func (h NativeHistogram) Count() float64 {
+	count := h.ZeroCount
+	for _, c := range h.PositiveBuckets {
+		count += c
+	}
+	for _, c := range h.NegativeBuckets {
+		count += c
+	}
+	return count
+}
+
+// Buckets returns every bucket, including the zero bucket, in ascending order
+func (h NativeHistogram) Buckets() []NativeBucket {
+	var buckets []NativeBucket
+
+	negative := bucketMap(h.NegativeSpans, h.NegativeBuckets)
+	for _, idx := range sortedIndices(negative, true) {
+		buckets = append(buckets, NativeBucket{
+			Lower: -bucketUpperBound(h.Schema, idx),
+			Upper: -bucketUpperBound(h.Schema, idx-1),
+			Count: negative[idx],
+		})
+	}
+
+	if h.ZeroThreshold > 0 || h.ZeroCount > 0 {
+		lower := -h.ZeroThreshold
+		if len(negative) == 0 {
+			lower = 0
+		}
+		buckets = append(buckets, NativeBucket{Lower: lower, Upper: h.ZeroThreshold, Count: h.ZeroCount})
+	}
+
+	positive := bucketMap(h.PositiveSpans, h.PositiveBuckets)
+	for _, idx := range sortedIndices(positive, false) {
+		buckets = append(buckets, NativeBucket{
+			Lower: bucketUpperBound(h.Schema, idx-1),
+			Upper: bucketUpperBound(h.Schema, idx),
+			Count: positive[idx],
+		})
+	}
+	return buckets
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) of the observations,
+// interpolating linearly within the bucket the quantile falls in.
+// Returns NaN if the histogram is empty.
+func (h NativeHistogram) Quantile(q float64) float64 {
+	if math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+	count := h.Count()
+	if count == 0 {
+		return math.NaN()
+	}
+
+	rank := q * count
+	buckets := h.Buckets()
+	cumulative := 0.0
+	for _, bucket := range buckets {
+		if bucket.Count == 0 {
+			continue
+		}
+		if cumulative+bucket.Count >= rank {
+			fraction := (rank - cumulative) / bucket.Count
+			return bucket.Lower + (bucket.Upper-bucket.Lower)*fraction
+		}
+		cumulative += bucket.Count
+	}
+	return buckets[len(buckets)-1].Upper
+}
+
+// Sub returns the observations made between prev and h. If the histograms
+// have different schemas the result uses the coarser of the two. If any
+// count went down, the histogram was reset and h itself is returned, the
+// same way prometheus treats counter resets in rate().
+func (h NativeHistogram) Sub(prev NativeHistogram) NativeHistogram {
+	if h.ZeroThreshold != prev.ZeroThreshold {
+		return h
+	}
+	schema := min(h.Schema, prev.Schema)
+	result := NativeHistogram{
+		Schema:        schema,
+		ZeroThreshold: h.ZeroThreshold,
+		ZeroCount:     h.ZeroCount - prev.ZeroCount,
+	}
+	if result.ZeroCount < 0 {
+		return h
+	}
+
+	var ok bool
+	result.PositiveSpans, result.PositiveBuckets, ok = subBuckets(
+		reduceBuckets(bucketMap(h.PositiveSpans, h.PositiveBuckets), h.Schema-schema),
+		reduceBuckets(bucketMap(prev.PositiveSpans, prev.PositiveBuckets), prev.Schema-schema),
+	)
+	if !ok {
+		return h
+	}
+	result.NegativeSpans, result.NegativeBuckets, ok = subBuckets(
+		reduceBuckets(bucketMap(h.NegativeSpans, h.NegativeBuckets), h.Schema-schema),
+		reduceBuckets(bucketMap(prev.NegativeSpans, prev.NegativeBuckets), prev.Schema-schema),
+	)
+	if !ok {
+		return h
+	}
+	return result
+}
+
+// String formats the buckets the way prometheus displays native histograms:
+// [a,b) for negative buckets, [a,b] for the zero bucket and (a,b] for positive ones.
+// Empty buckets are omitted.
+func (h NativeHistogram) String() string {
+	var parts []string
+	for _, bucket := range h.Buckets() {
+		if bucket.Count == 0 {
+			continue
+		}
+		switch {
+		case bucket.Upper < 0:
+			parts = append(parts, fmt.Sprintf("[%g,%g):%g", bucket.Lower, bucket.Upper, bucket.Count))
+		case bucket.Lower > 0:
+			parts = append(parts, fmt.Sprintf("(%g,%g]:%g", bucket.Lower, bucket.Upper, bucket.Count))
+		default:
+			parts = append(parts, fmt.Sprintf("[%g,%g]:%g", bucket.Lower, bucket.Upper, bucket.Count))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bucketMap expands spans and counts into a map of bucket index to count
+func bucketMap(spans []BucketSpan, counts []float64) map[int]float64 {
+	result := make(map[int]float64)
+	idx := 0
+	i := 0
+	for spanNum, span := range spans {
+		if spanNum == 0 {
+			idx = int(span.Offset)
+		} else {
+			idx += int(span.Offset)
+		}
+		for j := uint32(0); j < span.Length && i < len(counts); j++ {
+			result[idx] += counts[i]
+			idx++
+			i++
+		}
+	}
+	return result
+}
+
+// reduceBuckets merges buckets into a schema delta steps coarser
+func reduceBuckets(buckets map[int]float64, delta int32) map[int]float64 {
+	if delta == 0 {
+		return buckets
+	}
+	result := make(map[int]float64)
+	for idx, count := range buckets {
+		result[((idx-1)>>delta)+1] += count
+	}
+	return result
+}
+
+// subBuckets subtracts prev from cur, returning false if any count went down
+func subBuckets(cur, prev map[int]float64) ([]BucketSpan, []float64, bool) {
+	for idx, count := range prev {
+		if cur[idx] < count {
+			return nil, nil, false
+		}
+	}
+	delta := make(map[int]float64)
+	for idx, count := range cur {
+		delta[idx] = count - prev[idx]
+	}
+	spans, counts := spansFromMap(delta)
+	return spans, counts, true
+}
+
+// spansFromMap builds spans and counts from a map of bucket index to count
+func spansFromMap(buckets map[int]float64) ([]BucketSpan, []float64) {
+	var spans []BucketSpan
+	var counts []float64
+	next := 0
+	for _, idx := range sortedIndices(buckets, false) {
+		switch {
+		case len(spans) == 0:
+			spans = append(spans, BucketSpan{Offset: int32(idx), Length: 1})
+		case idx == next:
+			spans[len(spans)-1].Length++
+		default:
+			spans = append(spans, BucketSpan{Offset: int32(idx - next), Length: 1})
+		}
+		counts = append(counts, buckets[idx])
+		next = idx + 1
+	}
+	return spans, counts
+}
+
+func sortedIndices(buckets map[int]float64, descending bool) []int {
+	indices := make([]int, 0, len(buckets))
+	for idx := range buckets {
+		indices = append(indices, idx)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.IntSlice(indices)))
+	} else {
+		sort.Ints(indices)
+	}
+	return indices
+}
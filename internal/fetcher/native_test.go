@@ -0,0 +1,178 @@
+package fetcher
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// testNativeHistogram has buckets [-2,-1):1, [-0.001,0.001]:2, (0.5,1]:1, (1,2]:3 and (4,8]:2
+func testNativeHistogram() *dto.Histogram {
+	schema := int32(0)
+	zeroThreshold := 0.001
+	zeroCount := uint64(2)
+	sampleCount := uint64(9)
+	sampleSum := 21.5
+	span := func(offset int32, length uint32) *dto.BucketSpan {
+		return &dto.BucketSpan{Offset: &offset, Length: &length}
+	}
+	return &dto.Histogram{
+		SampleCount:   &sampleCount,
+		SampleSum:     &sampleSum,
+		Schema:        &schema,
+		ZeroThreshold: &zeroThreshold,
+		ZeroCount:     &zeroCount,
+		PositiveSpan:  []*dto.BucketSpan{span(0, 2), span(1, 1)},
+		PositiveDelta: []int64{1, 2, -1},
+		NegativeSpan:  []*dto.BucketSpan{span(1, 1)},
+		NegativeDelta: []int64{1},
+	}
+}
+
+func TestNativeHistogram_Convert(t *testing.T) {
+	h := testNativeHistogram()
+	if !isNativeHistogram(h) {
+		t.Fatal("expected histogram to be detected as native")
+	}
+	if isNativeHistogram(&dto.Histogram{Bucket: []*dto.Bucket{{}}}) {
+		t.Error("expected classic histogram not to be detected as native")
+	}
+
+	n := convertNativeHistogram(h)
+	if n.Schema != 0 || n.ZeroThreshold != 0.001 || n.ZeroCount != 2 {
+		t.Errorf("unexpected native histogram %+v", n)
+	}
+	expected := []float64{1, 3, 2}
+	for i, c := range expected {
+		if n.PositiveBuckets[i] != c {
+			t.Errorf("positive bucket %d: expected %f, got %f", i, c, n.PositiveBuckets[i])
+		}
+	}
+	if n.Count() != 9 {
+		t.Errorf("expected count 9, got %f", n.Count())
+	}
+}
+
+func TestNativeHistogram_String(t *testing.T) {
+	n := convertNativeHistogram(testNativeHistogram())
+	expected := "[-2,-1):1, [-0.001,0.001]:2, (0.5,1]:1, (1,2]:3, (4,8]:2"
+	if got := n.String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestNativeHistogram_Quantile(t *testing.T) {
+	n := convertNativeHistogram(testNativeHistogram())
+
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0, -2},
+		{0.5, 1 + 1.0/6},
+		{1, 8},
+	}
+	for _, tc := range tests {
+		if got := n.Quantile(tc.q); math.Abs(got-tc.expected) > 1e-9 {
+			t.Errorf("quantile %g: expected %f, got %f", tc.q, tc.expected, got)
+		}
+	}
+
+	if !math.IsNaN((NativeHistogram{}).Quantile(0.5)) {
+		t.Error("expected NaN for an empty histogram")
+	}
+}
+
+func TestNativeHistogram_Sub(t *testing.T) {
+	prev := NativeHistogram{
+		Schema:          0,
+		ZeroCount:       1,
+		PositiveSpans:   []BucketSpan{{Offset: 0, Length: 2}},
+		PositiveBuckets: []float64{1, 1},
+	}
+	cur := NativeHistogram{
+		Schema:          0,
+		ZeroCount:       3,
+		PositiveSpans:   []BucketSpan{{Offset: 0, Length: 2}, {Offset: 1, Length: 1}},
+		PositiveBuckets: []float64{1, 4, 2},
+	}
+
+	delta := cur.Sub(prev)
+	if delta.ZeroCount != 2 {
+		t.Errorf("expected zero count delta 2, got %f", delta.ZeroCount)
+	}
+	if got := delta.String(); got != "[0,0]:2, (1,2]:3, (4,8]:2" {
+		t.Errorf("unexpected delta %q", got)
+	}
+
+	// A count going down means the histogram was reset
+	reset := prev.Sub(cur)
+	if reset.Count() != prev.Count() {
+		t.Errorf("expected reset to return the current histogram, got %+v", reset)
+	}
+}
+
+func TestNativeHistogram_SubAcrossSchemas(t *testing.T) {
+	// At schema 1, buckets 1 and 2 are (1,1.41] and (1.41,2], which merge
+	// into bucket 1, (1,2], at schema 0
+	prev := NativeHistogram{
+		Schema:          0,
+		PositiveSpans:   []BucketSpan{{Offset: 1, Length: 1}},
+		PositiveBuckets: []float64{2},
+	}
+	cur := NativeHistogram{
+		Schema:          1,
+		PositiveSpans:   []BucketSpan{{Offset: 1, Length: 2}},
+		PositiveBuckets: []float64{2, 3},
+	}
+
+	delta := cur.Sub(prev)
+	if delta.Schema != 0 {
+		t.Errorf("expected the coarser schema 0, got %d", delta.Schema)
+	}
+	if got := delta.String(); got != "(1,2]:3" {
+		t.Errorf("unexpected delta %q", got)
+	}
+}
+
+func TestFetchNativeHistogram(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+		w.Header().Set("Content-Type", string(format))
+		name := "rpc_latency_seconds"
+		help := "RPC latency."
+		family := &dto.MetricFamily{
+			Name:   &name,
+			Help:   &help,
+			Type:   dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Histogram: testNativeHistogram()}},
+		}
+		if err := expfmt.NewEncoder(w, format).Encode(family); err != nil {
+			t.Errorf("failed to encode: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	metrics, err := New(server.URL, nil).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if len(metrics) != 1 || metrics[0].NativeHistogram == nil {
+		t.Fatalf("expected a native histogram, got %+v", metrics)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, metrics); err != nil {
+		t.Fatal(err)
+	}
+	expected := "rpc_latency_seconds {count:9, sum:21.5, [-2,-1):1, [-0.001,0.001]:2, (0.5,1]:1, (1,2]:3, (4,8]:2}"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected output to contain %q, got:\n%s", expected, buf.String())
+	}
+}
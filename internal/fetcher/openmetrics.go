@@ -0,0 +1,586 @@
+package fetcher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// omFamily is a metric family being assembled by the OpenMetrics parser
+type omFamily struct {
+	name       string // family name as declared in the metadata
+	omType     string // OpenMetrics type, e.g. "gaugehistogram"
+	family     *dto.MetricFamily
+	metrics    map[string]*dto.Metric // keyed by label signature
+	hasTypeDef bool
+}
+
+// omLabel is a single parsed label pair
+type omLabel struct {
+	name  string
+	value string
+}
+
+// omSample is a single parsed sample line
+type omSample struct {
+	name      string
+	labels    []omLabel
+	value     float64
+	timestamp *float64
+	exemplar  *dto.Exemplar
+}
+
+// omParser parses the OpenMetrics text format into metric families
+type omParser struct {
+	families map[string]*dto.MetricFamily
+	current  *omFamily
+	line     int
+	filter   *Filter
+	samples  *sampleCounter
+}
+
+// parseOpenMetrics parses an OpenMetrics text exposition into metric families.
+// Counters are named with their _total suffix so they match the names the
+// prometheus text and protobuf formats use for the same family. Samples of
+// series not selected by filter are dropped as they are read.
+func parseOpenMetrics(r io.Reader, filter *Filter, samples *sampleCounter) (map[string]*dto.MetricFamily, error) {
+	p := &omParser{families: make(map[string]*dto.MetricFamily), filter: filter, samples: samples}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	sawEOF := false
+	for scanner.Scan() {
+		p.line++
+		line := scanner.Text()
+		if sawEOF {
+			return nil, p.errorf("unexpected content after # EOF")
+		}
+		if line == "# EOF" {
+			sawEOF = true
+			continue
+		}
+		var err error
+		if strings.HasPrefix(line, "#") {
+			err = p.parseMetadata(line)
+		} else {
+			err = p.parseSample(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawEOF {
+		return nil, fmt.Errorf("openmetrics: missing # EOF")
+	}
+	return p.families, nil
+}
+
+func (p *omParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("openmetrics: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// parseMetadata handles # TYPE, # HELP and # UNIT lines
+func (p *omParser) parseMetadata(line string) error {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 || parts[0] != "#" {
+		return p.errorf("invalid metadata line %q", line)
+	}
+	keyword, name := parts[1], parts[2]
+	text := ""
+	if len(parts) == 4 {
+		text = parts[3]
+	}
+
+	family := p.current
+	if family == nil || family.name != name {
+		for _, omType := range []string{"unknown", "counter", "info"} {
+			if _, exists := p.families[omFamilyName(name, omType)]; exists {
+				return p.errorf("metadata for %s is not contiguous with its family", name)
+			}
+		}
+		family = p.startFamily(name, "unknown")
+	}
+
+	switch keyword {
+	case "TYPE":
+		if family.hasTypeDef || len(family.family.Metric) > 0 {
+			return p.errorf("unexpected TYPE for %s", name)
+		}
+		metricType, ok := omTypes[text]
+		if !ok {
+			return p.errorf("unknown metric type %q", text)
+		}
+		family.omType = text
+		family.hasTypeDef = true
+		family.family.Type = metricType.Enum()
+		p.renameFamily(family)
+	case "HELP":
+		help, err := unescapeOM(text)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		family.family.Help = &help
+	case "UNIT":
+		family.family.Unit = &text
+	default:
+		return p.errorf("unknown metadata keyword %q", keyword)
+	}
+	return nil
+}
+
+// omTypes maps OpenMetrics types onto the closest prometheus metric type
+var omTypes = map[string]dto.MetricType{
+	"counter":        dto.MetricType_COUNTER,
+	"gauge":          dto.MetricType_GAUGE,
+	"histogram":      dto.MetricType_HISTOGRAM,
+	"gaugehistogram": dto.MetricType_GAUGE_HISTOGRAM,
+	"summary":        dto.MetricType_SUMMARY,
+	"info":           dto.MetricType_GAUGE,
+	"stateset":       dto.MetricType_GAUGE,
+	"unknown":        dto.MetricType_UNTYPED,
+}
+
+// omSuffixes lists the sample name suffixes each type allows
+var omSuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"gauge":          {""},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"", "_count", "_sum", "_created"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// omFamilyName is the name a family is stored under in the results
+func omFamilyName(name, omType string) string {
+	switch omType {
+	case "counter":
+		if !strings.HasSuffix(name, "_total") {
+			return name + "_total"
+		}
+	case "info":
+		if !strings.HasSuffix(name, "_info") {
+			return name + "_info"
+		}
+	}
+	return name
+}
+
+func (p *omParser) startFamily(name, omType string) *omFamily {
+	family := &omFamily{
+		name:    name,
+		omType:  omType,
+		metrics: make(map[string]*dto.Metric),
+		family: &dto.MetricFamily{
+			Type: omTypes[omType].Enum(),
+		},
+	}
+	p.current = family
+	p.renameFamily(family)
+	return family
+}
+
+// renameFamily (re)registers the family under the name its type implies
+func (p *omParser) renameFamily(family *omFamily) {
+	if family.family.Name != nil {
+		delete(p.families, family.family.GetName())
+	}
+	name := omFamilyName(family.name, family.omType)
+	family.family.Name = &name
+	p.families[name] = family.family
+}
+
+// parseSample handles a sample line, attaching it to the current family or
+// starting a new untyped family
+func (p *omParser) parseSample(line string) error {
+	sample, err := parseOMSample(line)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+
+	family := p.current
+	suffix, ok := "", false
+	if family != nil {
+		suffix, ok = family.matchSuffix(sample.name)
+	}
+	if !ok {
+		if _, exists := p.families[sample.name]; exists {
+			return p.errorf("samples for %s are not contiguous", sample.name)
+		}
+		family = p.startFamily(sample.name, "unknown")
+		suffix = ""
+	}
+
+	// Group samples into metrics by their labels, ignoring le and quantile
+	var labels []*dto.LabelPair
+	var le, quantile string
+	var signature strings.Builder
+	for _, l := range sample.labels {
+		switch {
+		case l.name == "le" && (family.omType == "histogram" || family.omType == "gaugehistogram"):
+			le = l.value
+			continue
+		case l.name == "quantile" && family.omType == "summary":
+			quantile = l.value
+			continue
+		}
+		labels = append(labels, &dto.LabelPair{Name: &l.name, Value: &l.value})
+		signature.WriteString(l.name)
+		signature.WriteByte(0)
+		signature.WriteString(l.value)
+		signature.WriteByte(0)
+	}
+
+	if !p.selected(family, labels) {
+		return nil
+	}
+	if err := p.samples.add(1); err != nil {
+		return err
+	}
+
+	metric, exists := family.metrics[signature.String()]
+	if !exists {
+		metric = &dto.Metric{Label: labels}
+		family.metrics[signature.String()] = metric
+		family.family.Metric = append(family.family.Metric, metric)
+	}
+	if sample.timestamp != nil {
+		ms := int64(math.Round(*sample.timestamp * 1000))
+		metric.TimestampMs = &ms
+	}
+
+	if sample.exemplar != nil && suffix != "_total" && suffix != "_bucket" {
+		return p.errorf("exemplars are only allowed on counters and histogram buckets")
+	}
+
+	value := sample.value
+	switch family.omType {
+	case "counter":
+		if metric.Counter == nil {
+			metric.Counter = &dto.Counter{}
+		}
+		switch suffix {
+		case "_total":
+			metric.Counter.Value = &value
+			metric.Counter.Exemplar = sample.exemplar
+		case "_created":
+			metric.Counter.CreatedTimestamp = secondsToTimestamp(value)
+		}
+	case "gauge", "info", "stateset":
+		metric.Gauge = &dto.Gauge{Value: &value}
+	case "unknown":
+		metric.Untyped = &dto.Untyped{Value: &value}
+	case "histogram", "gaugehistogram":
+		if metric.Histogram == nil {
+			metric.Histogram = &dto.Histogram{}
+		}
+		h := metric.Histogram
+		switch suffix {
+		case "_bucket":
+			upperBound, err := strconv.ParseFloat(le, 64)
+			if err != nil {
+				return p.errorf("invalid le label %q", le)
+			}
+			count := uint64(value)
+			h.Bucket = append(h.Bucket, &dto.Bucket{
+				UpperBound:      &upperBound,
+				CumulativeCount: &count,
+				Exemplar:        sample.exemplar,
+			})
+		case "_count", "_gcount":
+			count := uint64(value)
+			h.SampleCount = &count
+		case "_sum", "_gsum":
+			h.SampleSum = &value
+		case "_created":
+			h.CreatedTimestamp = secondsToTimestamp(value)
+		}
+	case "summary":
+		if metric.Summary == nil {
+			metric.Summary = &dto.Summary{}
+		}
+		s := metric.Summary
+		switch suffix {
+		case "":
+			q, err := strconv.ParseFloat(quantile, 64)
+			if err != nil {
+				return p.errorf("invalid quantile label %q", quantile)
+			}
+			s.Quantile = append(s.Quantile, &dto.Quantile{Quantile: &q, Value: &value})
+		case "_count":
+			count := uint64(value)
+			s.SampleCount = &count
+		case "_sum":
+			s.SampleSum = &value
+		case "_created":
+			s.CreatedTimestamp = secondsToTimestamp(value)
+		}
+	}
+	return nil
+}
+
+// selected reports whether the filter selects the series a sample belongs to
+func (p *omParser) selected(family *omFamily, labels []*dto.LabelPair) bool {
+	if p.filter == nil {
+		return true
+	}
+	name := family.family.GetName()
+	if !p.filter.MatchesName(name) {
+		return false
+	}
+	return !p.filter.usesLabels() || p.filter.Matches(name, metricLabels(&dto.Metric{Label: labels}))
+}
+
+// matchSuffix reports whether a sample name belongs to this family, and
+// which of the type's suffixes it carries
+func (f *omFamily) matchSuffix(sampleName string) (string, bool) {
+	for _, suffix := range omSuffixes[f.omType] {
+		if sampleName == f.name+suffix {
+			return suffix, true
+		}
+	}
+	// Tolerate counters declared with their _total suffix
+	if f.omType == "counter" && strings.HasSuffix(f.name, "_total") {
+		base := strings.TrimSuffix(f.name, "_total")
+		if sampleName == base+"_created" {
+			return "_created", true
+		}
+		if sampleName == f.name {
+			return "_total", true
+		}
+	}
+	return "", false
+}
+
+func secondsToTimestamp(seconds float64) *timestamppb.Timestamp {
+	sec, frac := math.Modf(seconds)
+	return &timestamppb.Timestamp{Seconds: int64(sec), Nanos: int32(math.Round(frac * 1e9))}
+}
+
+// parseOMSample parses `name{labels} value [timestamp] [# {labels} value [timestamp]]`
+func parseOMSample(line string) (omSample, error) {
+	var sample omSample
+	l := &omLexer{s: line}
+
+	sample.name = l.metricName()
+	if sample.name == "" {
+		return sample, fmt.Errorf("expected metric name in %q", line)
+	}
+	if l.peek() == '{' {
+		labels, err := l.labels()
+		if err != nil {
+			return sample, err
+		}
+		sample.labels = labels
+	}
+
+	if !l.consume(' ') {
+		return sample, fmt.Errorf("expected value after %s", sample.name)
+	}
+	value, err := l.float()
+	if err != nil {
+		return sample, err
+	}
+	sample.value = value
+
+	if l.consume(' ') && l.peek() != '#' {
+		ts, err := l.float()
+		if err != nil {
+			return sample, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		sample.timestamp = &ts
+		l.consume(' ')
+	}
+
+	if l.peek() == '#' {
+		exemplar, err := l.exemplar()
+		if err != nil {
+			return sample, err
+		}
+		sample.exemplar = exemplar
+	}
+
+	if !l.done() {
+		return sample, fmt.Errorf("unexpected %q at end of sample", l.s[l.pos:])
+	}
+	return sample, nil
+}
+
+// omLexer tokenizes a single OpenMetrics sample line
+type omLexer struct {
+	s   string
+	pos int
+}
+
+func (l *omLexer) done() bool {
+	return l.pos >= len(l.s)
+}
+
+func (l *omLexer) peek() byte {
+	if l.done() {
+		return 0
+	}
+	return l.s[l.pos]
+}
+
+func (l *omLexer) consume(c byte) bool {
+	if l.peek() == c && !l.done() {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// isLabelNameChar is isNameChar without colons, which only metric names have
+func isLabelNameChar(c byte, first bool) bool {
+	return c != ':' && isNameChar(c, first)
+}
+
+func (l *omLexer) metricName() string {
+	start := l.pos
+	for !l.done() && isNameChar(l.s[l.pos], l.pos == start) {
+		l.pos++
+	}
+	return l.s[start:l.pos]
+}
+
+func (l *omLexer) labelName() string {
+	start := l.pos
+	for !l.done() && isLabelNameChar(l.s[l.pos], l.pos == start) {
+		l.pos++
+	}
+	return l.s[start:l.pos]
+}
+
+// labels parses {name="value",...}
+func (l *omLexer) labels() ([]omLabel, error) {
+	if !l.consume('{') {
+		return nil, fmt.Errorf("expected {")
+	}
+	var labels []omLabel
+	for !l.consume('}') {
+		name := l.labelName()
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at %q", l.s[l.pos:])
+		}
+		if !l.consume('=') {
+			return nil, fmt.Errorf("expected = after label %s", name)
+		}
+		value, err := l.quoted()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, omLabel{name: name, value: value})
+		if !l.consume(',') && l.peek() != '}' {
+			return nil, fmt.Errorf("expected , or } after label %s", name)
+		}
+	}
+	return labels, nil
+}
+
+// quoted parses a double-quoted label value, unescaping it
+func (l *omLexer) quoted() (string, error) {
+	if !l.consume('"') {
+		return "", fmt.Errorf("expected quoted label value")
+	}
+	start := l.pos
+	for !l.done() {
+		switch l.s[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '"':
+			raw := l.s[start:l.pos]
+			l.pos++
+			return unescapeOM(raw)
+		default:
+			l.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated label value")
+}
+
+// float parses a number token up to the next space
+func (l *omLexer) float() (float64, error) {
+	start := l.pos
+	for !l.done() && l.s[l.pos] != ' ' {
+		l.pos++
+	}
+	token := l.s[start:l.pos]
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return value, nil
+}
+
+// exemplar parses `# {labels} value [timestamp]`
+func (l *omLexer) exemplar() (*dto.Exemplar, error) {
+	if !l.consume('#') || !l.consume(' ') {
+		return nil, fmt.Errorf("expected exemplar")
+	}
+	labels, err := l.labels()
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar: %w", err)
+	}
+	if !l.consume(' ') {
+		return nil, fmt.Errorf("expected exemplar value")
+	}
+	value, err := l.float()
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar: %w", err)
+	}
+	exemplar := &dto.Exemplar{Value: &value}
+	for _, label := range labels {
+		exemplar.Label = append(exemplar.Label, &dto.LabelPair{Name: &label.name, Value: &label.value})
+	}
+	if l.consume(' ') {
+		ts, err := l.float()
+		if err != nil {
+			return nil, fmt.Errorf("invalid exemplar timestamp: %w", err)
+		}
+		exemplar.Timestamp = secondsToTimestamp(ts)
+	}
+	return exemplar, nil
+}
+
+// unescapeOM resolves the \\, \" and \n escapes used in label values and help text
+func unescapeOM(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("trailing backslash in %q", s)
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case '"':
+			b.WriteByte('"')
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in %q", s[i], s)
+		}
+	}
+	return b.String(), nil
+}
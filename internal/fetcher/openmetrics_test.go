@@ -0,0 +1,170 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const mockOpenMetricsData = `# HELP http_requests The total number of HTTP requests.
+# TYPE http_requests counter
+# UNIT http_requests requests
+http_requests_total{method="post",code="200"} 1027 # {trace_id="abc123"} 1 1700000000.5
+http_requests_created{method="post",code="200"} 1700000000.25
+http_requests_total{method="get",code="200"} 7
+# HELP request_duration_seconds Request latencies.
+# TYPE request_duration_seconds histogram
+# UNIT request_duration_seconds seconds
+request_duration_seconds_bucket{le="0.1"} 5
+request_duration_seconds_bucket{le="1.0"} 8 # {trace_id="def456"} 0.67
+request_duration_seconds_bucket{le="+Inf"} 9
+request_duration_seconds_count 9
+request_duration_seconds_sum 4.2
+request_duration_seconds_created 1700000000
+# TYPE queue_size gaugehistogram
+queue_size_bucket{le="10"} 3
+queue_size_bucket{le="+Inf"} 4
+queue_size_gcount 4
+queue_size_gsum 17
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05
+rpc_duration_seconds{quantile="0.99"} 0.3
+rpc_duration_seconds_count 100
+rpc_duration_seconds_sum 6.5
+# TYPE build info
+build_info{version="1.2.3"} 1
+# TYPE temperature gauge
+temperature{room="a \"quoted\" name\\with\nescapes"} -3.5 1700000001
+untyped_thing 42
+# EOF
+`
+
+func parseTestOpenMetrics(t *testing.T) map[string]*dto.MetricFamily {
+	t.Helper()
+	families, err := parseOpenMetrics(strings.NewReader(mockOpenMetricsData), nil, nil)
+	if err != nil {
+		t.Fatalf("failed to parse openmetrics: %v", err)
+	}
+	return families
+}
+
+func TestOpenMetrics_Counter(t *testing.T) {
+	families := parseTestOpenMetrics(t)
+
+	family, ok := families["http_requests_total"]
+	if !ok {
+		t.Fatalf("expected counter to be named with its _total suffix, got %v", familyNames(families))
+	}
+	if family.GetType() != dto.MetricType_COUNTER {
+		t.Errorf("expected counter, got %s", family.GetType())
+	}
+	if family.GetUnit() != "requests" {
+		t.Errorf("expected unit requests, got %q", family.GetUnit())
+	}
+	if family.GetHelp() != "The total number of HTTP requests." {
+		t.Errorf("unexpected help %q", family.GetHelp())
+	}
+	if len(family.GetMetric()) != 2 {
+		t.Fatalf("expected _created to merge into its series, got %d metrics", len(family.GetMetric()))
+	}
+
+	post := family.GetMetric()[0].GetCounter()
+	if post.GetValue() != 1027 {
+		t.Errorf("expected 1027, got %f", post.GetValue())
+	}
+	created := post.GetCreatedTimestamp().AsTime()
+	if created.Unix() != 1700000000 || created.Nanosecond() != 250000000 {
+		t.Errorf("unexpected created timestamp %v", created)
+	}
+	exemplar := post.GetExemplar()
+	if exemplar == nil {
+		t.Fatal("expected exemplar")
+	}
+	if exemplar.GetValue() != 1 || exemplar.GetLabel()[0].GetValue() != "abc123" {
+		t.Errorf("unexpected exemplar %v", exemplar)
+	}
+	if exemplar.GetTimestamp().AsTime().UnixMilli() != 1700000000500 {
+		t.Errorf("unexpected exemplar timestamp %v", exemplar.GetTimestamp().AsTime())
+	}
+}
+
+func TestOpenMetrics_Histograms(t *testing.T) {
+	families := parseTestOpenMetrics(t)
+
+	histogram := families["request_duration_seconds"].GetMetric()[0].GetHistogram()
+	if len(histogram.GetBucket()) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(histogram.GetBucket()))
+	}
+	if histogram.GetSampleCount() != 9 || histogram.GetSampleSum() != 4.2 {
+		t.Errorf("unexpected count/sum %d/%f", histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+	if histogram.GetBucket()[1].GetExemplar().GetValue() != 0.67 {
+		t.Errorf("expected bucket exemplar, got %v", histogram.GetBucket()[1].GetExemplar())
+	}
+	if histogram.GetCreatedTimestamp().AsTime().Unix() != 1700000000 {
+		t.Errorf("unexpected created timestamp %v", histogram.GetCreatedTimestamp())
+	}
+
+	gauge := families["queue_size"]
+	if gauge.GetType() != dto.MetricType_GAUGE_HISTOGRAM {
+		t.Errorf("expected gauge histogram, got %s", gauge.GetType())
+	}
+	if gauge.GetMetric()[0].GetHistogram().GetSampleCount() != 4 || gauge.GetMetric()[0].GetHistogram().GetSampleSum() != 17 {
+		t.Errorf("expected _gcount/_gsum to be parsed, got %v", gauge.GetMetric()[0].GetHistogram())
+	}
+}
+
+func TestOpenMetrics_OtherTypes(t *testing.T) {
+	families := parseTestOpenMetrics(t)
+
+	summary := families["rpc_duration_seconds"].GetMetric()[0].GetSummary()
+	if len(summary.GetQuantile()) != 2 || summary.GetSampleCount() != 100 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+
+	info, ok := families["build_info"]
+	if !ok || info.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Errorf("expected build_info gauge, got %v", info)
+	}
+
+	temperature := families["temperature"].GetMetric()[0]
+	if got := temperature.GetLabel()[0].GetValue(); got != "a \"quoted\" name\\with\nescapes" {
+		t.Errorf("label value not unescaped: %q", got)
+	}
+	if temperature.GetTimestampMs() != 1700000001000 {
+		t.Errorf("expected timestamp in ms, got %d", temperature.GetTimestampMs())
+	}
+
+	untyped := families["untyped_thing"]
+	if untyped.GetType() != dto.MetricType_UNTYPED || untyped.GetMetric()[0].GetUntyped().GetValue() != 42 {
+		t.Errorf("unexpected untyped family %v", untyped)
+	}
+}
+
+func TestOpenMetrics_Errors(t *testing.T) {
+	tests := map[string]string{
+		"missing EOF":            "foo 1\n",
+		"content after EOF":      "foo 1\n# EOF\nbar 2\n",
+		"bad value":              "foo abc\n# EOF\n",
+		"unterminated label":     "foo{a=\"b} 1\n# EOF\n",
+		"unknown type":           "# TYPE foo widget\n# EOF\n",
+		"exemplar on gauge":      "# TYPE foo gauge\nfoo 1 # {a=\"b\"} 1\n# EOF\n",
+		"non-contiguous samples": "foo 1\nbar 2\nfoo 3\n# EOF\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseOpenMetrics(strings.NewReader(input), nil, nil); err == nil {
+				t.Errorf("expected error parsing %q", input)
+			}
+		})
+	}
+}
+
+func familyNames(families map[string]*dto.MetricFamily) []string {
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,414 @@
+package fetcher
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MatchType is how a LabelMatcher compares a label's value
+type MatchType int
+
+const (
+	MatchEqual     MatchType = iota // =
+	MatchNotEqual                   // !=
+	MatchRegexp                     // =~
+	MatchNotRegexp                  // !~
+)
+
+// matchOperators are the operators of each MatchType, two-character
+// operators first so that = doesn't shadow =~
+var matchOperators = []struct {
+	op        string
+	matchType MatchType
+}{
+	{"!=", MatchNotEqual},
+	{"=~", MatchRegexp},
+	{"!~", MatchNotRegexp},
+	{"=", MatchEqual},
+}
+
+func (t MatchType) String() string {
+	for _, o := range matchOperators {
+		if o.matchType == t {
+			return o.op
+		}
+	}
+	return fmt.Sprintf("MatchType(%d)", int(t))
+}
+
+// LabelMatcher matches the value of one label, like a PromQL label matcher.
+// A missing label has the empty value, so name="" matches series without
+// the label. Regular expressions are anchored at both ends.
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewLabelMatcher creates a matcher, compiling its regular expression if it has one
+func NewLabelMatcher(name string, matchType MatchType, value string) (LabelMatcher, error) {
+	m := LabelMatcher{Name: name, Type: matchType, Value: value}
+	if matchType == MatchRegexp || matchType == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("invalid regular expression for label %s: %w", name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether value satisfies the matcher
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+func (m LabelMatcher) String() string {
+	return m.Name + m.Type.String() + strconv.Quote(m.Value)
+}
+
+// Selector selects series like a PromQL series selector, such as
+// http_requests_total{code=~"5..",method!="GET"}: the metric name, if any,
+// and every label matcher must match. The __name__ label matches the metric
+// name.
+type Selector struct {
+	Name     string
+	Matchers []LabelMatcher
+}
+
+// Matches reports whether a series with the given metric name and labels is selected
+func (s Selector) Matches(name string, labels map[string]string) bool {
+	if s.Name != "" && s.Name != name {
+		return false
+	}
+	for _, m := range s.Matchers {
+		value := labels[m.Name]
+		if m.Name == "__name__" {
+			value = name
+		}
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesName reports whether series of the metric family called name could
+// be selected, looking only at the selector's name and __name__ matchers
+func (s Selector) matchesName(name string) bool {
+	return Selector{Name: s.Name, Matchers: s.nameMatchers()}.Matches(name, nil)
+}
+
+// selectsWholeFamilies reports whether the selector only matches on the
+// metric name, so that it selects either every series of a family or none
+func (s Selector) selectsWholeFamilies() bool {
+	return len(s.nameMatchers()) == len(s.Matchers)
+}
+
+func (s Selector) nameMatchers() []LabelMatcher {
+	var matchers []LabelMatcher
+	for _, m := range s.Matchers {
+		if m.Name == "__name__" {
+			matchers = append(matchers, m)
+		}
+	}
+	return matchers
+}
+
+func (s Selector) String() string {
+	if len(s.Matchers) == 0 {
+		return s.Name
+	}
+	matchers := make([]string, len(s.Matchers))
+	for i, m := range s.Matchers {
+		matchers[i] = m.String()
+	}
+	return s.Name + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// ParseSelector parses a series selector: a metric name, label matchers in
+// braces, or both. Values are quoted with double quotes or backticks. The
+// name can also be a pattern, as described by parseNamePattern.
+func ParseSelector(input string) (Selector, error) {
+	var s Selector
+	name, rest := strings.TrimSpace(input), ""
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		name, rest = strings.TrimSpace(name[:i]), name[i:]
+	}
+	if plain, _ := cutName(name, isNameChar); plain == name {
+		s.Name = name
+	} else {
+		m, err := parseNamePattern(name)
+		if err != nil {
+			return s, err
+		}
+		s.Matchers = append(s.Matchers, m)
+	}
+	if rest == "" {
+		if name == "" {
+			return s, fmt.Errorf("empty selector")
+		}
+		return s, nil
+	}
+	if !strings.HasSuffix(rest, "}") {
+		return s, fmt.Errorf("invalid selector %q: expected label matchers in braces after the metric name", input)
+	}
+
+	rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	for rest != "" {
+		var name, value string
+		var matchType MatchType
+		var ok bool
+		var err error
+		name, rest = cutName(rest, isLabelNameChar)
+		if name == "" {
+			return s, fmt.Errorf("invalid selector %q: expected a label name at %q", input, rest)
+		}
+		if matchType, rest, ok = cutOperator(strings.TrimSpace(rest)); !ok {
+			return s, fmt.Errorf("invalid selector %q: expected =, !=, =~ or !~ after %s", input, name)
+		}
+		if value, rest, err = cutQuoted(strings.TrimSpace(rest)); err != nil {
+			return s, fmt.Errorf("invalid selector %q: value of %s: %w", input, name, err)
+		}
+		m, err := NewLabelMatcher(name, matchType, value)
+		if err != nil {
+			return s, err
+		}
+		s.Matchers = append(s.Matchers, m)
+
+		rest = strings.TrimSpace(rest)
+		if rest != "" {
+			if rest[0] != ',' {
+				return s, fmt.Errorf("invalid selector %q: expected , between label matchers at %q", input, rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	if s.Name == "" && len(s.Matchers) == 0 {
+		return s, fmt.Errorf("empty selector")
+	}
+	return s, nil
+}
+
+// regexpChars are the characters that make a metric name pattern a regular
+// expression rather than a glob
+const regexpChars = `.+()|^$\`
+
+// parseNamePattern parses a metric name pattern into a __name__ matcher.
+// Patterns using any regular expression syntax, like go_gc_.*, are regular
+// expressions. Others are globs, like process_*, where * matches any
+// characters, ? matches one, and [...] matches a class of characters.
+func parseNamePattern(pattern string) (LabelMatcher, error) {
+	if strings.ContainsFunc(pattern, unicode.IsSpace) {
+		return LabelMatcher{}, fmt.Errorf("invalid metric name pattern %q", pattern)
+	}
+	if strings.ContainsAny(pattern, regexpChars) {
+		return NewLabelMatcher("__name__", MatchRegexp, pattern)
+	}
+	return NewLabelMatcher("__name__", MatchRegexp, globToRegexp(pattern))
+}
+
+// globToRegexp converts a glob into an equivalent regular expression
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	inClass := false
+	for i, c := range glob {
+		switch {
+		case inClass:
+			if c == '!' && glob[i-1] == '[' {
+				c = '^'
+			}
+			inClass = c != ']'
+			re.WriteRune(c)
+		case c == '*':
+			re.WriteString(".*")
+		case c == '?':
+			re.WriteString(".")
+		case c == '[':
+			inClass = true
+			re.WriteRune(c)
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
+
+// ParseLabelMatcher parses a single matcher given on the command line, such
+// as code=500, method!=GET or code=~5... The value is everything after the
+// operator, and may be quoted. A label name alone matches series that have
+// the label.
+func ParseLabelMatcher(input string) (LabelMatcher, error) {
+	name, rest := cutName(input, isLabelNameChar)
+	if name == "" {
+		return LabelMatcher{}, fmt.Errorf("invalid label matcher %q: expected a label name", input)
+	}
+	if rest == "" {
+		return NewLabelMatcher(name, MatchNotEqual, "")
+	}
+	matchType, value, ok := cutOperator(rest)
+	if !ok {
+		return LabelMatcher{}, fmt.Errorf("invalid label matcher %q: expected =, !=, =~ or !~ after %s", input, name)
+	}
+	if unquoted, rest, err := cutQuoted(value); err == nil && rest == "" {
+		value = unquoted
+	}
+	return NewLabelMatcher(name, matchType, value)
+}
+
+// cutName splits a leading name made of the characters accepted by isChar
+func cutName(s string, isChar func(c byte, first bool) bool) (name, rest string) {
+	i := 0
+	for i < len(s) && isChar(s[i], i == 0) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// cutOperator splits a leading match operator
+func cutOperator(s string) (MatchType, string, bool) {
+	for _, o := range matchOperators {
+		if rest, ok := strings.CutPrefix(s, o.op); ok {
+			return o.matchType, rest, true
+		}
+	}
+	return 0, s, false
+}
+
+// cutQuoted splits a leading string quoted with double quotes or backticks
+func cutQuoted(s string) (value, rest string, err error) {
+	if s == "" || (s[0] != '"' && s[0] != '`') {
+		return "", s, fmt.Errorf("expected a quoted string")
+	}
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++ // skip the escaped character
+		case s[i] == quote:
+			value, err := strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err
+		}
+	}
+	return "", s, fmt.Errorf("unterminated quoted string")
+}
+
+// Filter selects the series a fetcher returns, from the --metric,
+// --exclude-metric and --label flags. A series is selected if it matches any
+// of Selectors, or there are none, none of Exclude, and every one of
+// Matchers. A nil Filter selects everything.
+type Filter struct {
+	Selectors []Selector
+	Exclude   []Selector
+	Matchers  []LabelMatcher
+}
+
+// ParseFilter parses metric names, patterns or selectors to select and to
+// exclude, and label matchers. It returns nil if they are all empty.
+func ParseFilter(selectors, exclude, matchers []string) (*Filter, error) {
+	if len(selectors) == 0 && len(exclude) == 0 && len(matchers) == 0 {
+		return nil, nil
+	}
+	f := &Filter{}
+	for _, input := range selectors {
+		s, err := ParseSelector(input)
+		if err != nil {
+			return nil, err
+		}
+		f.Selectors = append(f.Selectors, s)
+	}
+	for _, input := range exclude {
+		s, err := ParseSelector(input)
+		if err != nil {
+			return nil, err
+		}
+		f.Exclude = append(f.Exclude, s)
+	}
+	for _, input := range matchers {
+		m, err := ParseLabelMatcher(input)
+		if err != nil {
+			return nil, err
+		}
+		f.Matchers = append(f.Matchers, m)
+	}
+	return f, nil
+}
+
+// MatchesName reports whether any series of the metric family called name
+// could be selected, so that other families are skipped before their
+// samples are converted
+func (f *Filter) MatchesName(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, s := range f.Exclude {
+		if s.selectsWholeFamilies() && s.matchesName(name) {
+			return false
+		}
+	}
+	if len(f.Selectors) == 0 {
+		return true
+	}
+	for _, s := range f.Selectors {
+		if s.matchesName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesLabels reports whether the filter looks at labels besides the metric
+// name, so that MatchesName alone doesn't decide whether a series is selected
+func (f *Filter) usesLabels() bool {
+	if f == nil {
+		return false
+	}
+	if len(f.Matchers) > 0 {
+		return true
+	}
+	for _, s := range slices.Concat(f.Selectors, f.Exclude) {
+		if !s.selectsWholeFamilies() {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a series with the given metric name and labels is selected
+func (f *Filter) Matches(name string, labels map[string]string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Selectors) > 0 && !matchesAny(f.Selectors, name, labels) {
+		return false
+	}
+	if matchesAny(f.Exclude, name, labels) {
+		return false
+	}
+	return Selector{Matchers: f.Matchers}.Matches(name, labels)
+}
+
+// matchesAny reports whether any of selectors selects the series
+func matchesAny(selectors []Selector, name string, labels map[string]string) bool {
+	for _, s := range selectors {
+		if s.Matches(name, labels) {
+			return true
+		}
+	}
+	return false
+}
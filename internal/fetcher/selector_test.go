@@ -0,0 +1,250 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustFilter parses --metric and --label style filters, failing the test on error
+func mustFilter(t *testing.T, selectors, matchers []string) *Filter {
+	t.Helper()
+	filter, err := ParseFilter(selectors, nil, matchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"http_requests_total", "http_requests_total"},
+		{`http_requests_total{code=~"5..",method!="GET"}`, `http_requests_total{code=~"5..",method!="GET"}`},
+		{` up { job = "node" , } `, `up{job="node"}`},
+		{`{__name__=~"go_.*"}`, `{__name__=~"go_.*"}`},
+		{"ns:rate5m{a=`back\\slash`}", `ns:rate5m{a="back\\slash"}`},
+		{`x{a="quoted \" and , comma"}`, `x{a="quoted \" and , comma"}`},
+		{`x{a!~""}`, `x{a!~""}`},
+		{"go_gc_.*", `{__name__=~"go_gc_.*"}`},
+		{"process_*", `{__name__=~"process_.*"}`},
+		{"go_?c_[!a-c]*", `{__name__=~"go_.c_[^a-c].*"}`},
+		{`process_*{job="node"}`, `{__name__=~"process_.*",job="node"}`},
+	}
+	for _, tc := range tests {
+		s, err := ParseSelector(tc.input)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tc.input, err)
+			continue
+		}
+		if got := s.String(); got != tc.expected {
+			t.Errorf("ParseSelector(%q) = %s, expected %s", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestParseSelector_Errors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "empty selector"},
+		{"{}", "empty selector"},
+		{"x{", "expected label matchers in braces"},
+		{"x y", "invalid metric name pattern"},
+		{"go_(", "invalid regular expression for label __name__"},
+		{`x{="a"}`, "expected a label name"},
+		{`x{a~"b"}`, "expected =, !=, =~ or !~ after a"},
+		{`x{a=b}`, "expected a quoted string"},
+		{`x{a="b}`, "unterminated quoted string"},
+		{`x{a="b" c="d"}`, "expected , between label matchers"},
+		{`x{a=~"("}`, "invalid regular expression for label a"},
+	}
+	for _, tc := range tests {
+		_, err := ParseSelector(tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("ParseSelector(%q): expected an error containing %q, got %v", tc.input, tc.expected, err)
+		}
+	}
+}
+
+func TestParseLabelMatcher(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"method", `method!=""`},
+		{"method=post", `method="post"`},
+		{"method!=GET", `method!="GET"`},
+		{"code=~5..", `code=~"5.."`},
+		{"code!~2..|3..", `code!~"2..|3.."`},
+		{"query=a=b", `query="a=b"`},
+		{`path="/a b"`, `path="/a b"`},
+		{"empty=", `empty=""`},
+	}
+	for _, tc := range tests {
+		m, err := ParseLabelMatcher(tc.input)
+		if err != nil {
+			t.Errorf("ParseLabelMatcher(%q): %v", tc.input, err)
+			continue
+		}
+		if got := m.String(); got != tc.expected {
+			t.Errorf("ParseLabelMatcher(%q) = %s, expected %s", tc.input, got, tc.expected)
+		}
+	}
+
+	for _, input := range []string{"", "=post", "method~post", "code=~("} {
+		if _, err := ParseLabelMatcher(input); err == nil {
+			t.Errorf("ParseLabelMatcher(%q): expected an error", input)
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"code": "503", "method": "POST"}
+	tests := []struct {
+		selector string
+		name     string
+		expected bool
+	}{
+		{"http_requests_total", "http_requests_total", true},
+		{"http_requests_total", "http_requests", false},
+		{`http_requests_total{code=~"5.."}`, "http_requests_total", true},
+		{`http_requests_total{code=~"5"}`, "http_requests_total", false}, // anchored
+		{`{code=~"5..",method!="GET"}`, "anything", true},
+		{`{code=~"5..",method!="POST"}`, "anything", false},
+		{`{code!~"5.."}`, "anything", false},
+		{`{missing=""}`, "anything", true},
+		{`{missing!=""}`, "anything", false},
+		{`{__name__=~"http_.*"}`, "http_requests_total", true},
+		{`{__name__=~"http_.*"}`, "go_goroutines", false},
+	}
+	for _, tc := range tests {
+		s, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Matches(tc.name, labels); got != tc.expected {
+			t.Errorf("%s matching %s%v = %v, expected %v", tc.selector, tc.name, labels, got, tc.expected)
+		}
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	// Selectors are alternatives, label matchers all have to match
+	filter := mustFilter(t,
+		[]string{`http_requests_total{code="200"}`, "go_goroutines"},
+		[]string{"method", "method!=get"})
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected bool
+	}{
+		{"http_requests_total", map[string]string{"code": "200", "method": "post"}, true},
+		{"http_requests_total", map[string]string{"code": "400", "method": "post"}, false},
+		{"http_requests_total", map[string]string{"code": "200", "method": "get"}, false},
+		{"go_goroutines", map[string]string{"method": "post"}, true},
+		{"go_goroutines", nil, false},
+		{"go_threads", map[string]string{"method": "post"}, false},
+	}
+	for _, tc := range tests {
+		if got := filter.Matches(tc.name, tc.labels); got != tc.expected {
+			t.Errorf("Matches(%s, %v) = %v, expected %v", tc.name, tc.labels, got, tc.expected)
+		}
+	}
+
+	if !filter.MatchesName("go_goroutines") || filter.MatchesName("go_threads") {
+		t.Error("Expected MatchesName to only accept selected metric names")
+	}
+
+	var none *Filter
+	if !none.Matches("anything", nil) || !none.MatchesName("anything") {
+		t.Error("Expected a nil filter to match everything")
+	}
+}
+
+func TestFilter_NamePatterns(t *testing.T) {
+	filter, err := ParseFilter([]string{"go_gc_.*", "process_*"}, []string{"*_total", `go_gc_pauses{quantile="1"}`}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		family   bool // whether MatchesName accepts the family
+		expected bool // whether a series with quantile="1" is selected
+	}{
+		{"go_gc_duration_seconds", true, true},
+		{"go_gc_pauses", true, false},
+		{"go_goroutines", false, false},
+		{"process_open_fds", true, true},
+		{"process_cpu_seconds_total", false, false},
+		{"xprocess_open_fds", false, false}, // patterns match whole names
+	}
+	for _, tc := range tests {
+		if got := filter.MatchesName(tc.name); got != tc.family {
+			t.Errorf("MatchesName(%s) = %v, expected %v", tc.name, got, tc.family)
+		}
+		if got := filter.Matches(tc.name, map[string]string{"quantile": "1"}); got != tc.expected {
+			t.Errorf("Matches(%s) = %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestFetchWithSelector(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	filter := mustFilter(t, []string{`http_requests_total{code=~"4..",method!="get"}`}, nil)
+	metrics, err := New(server.URL, filter).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %d", len(metrics))
+	}
+	if got := metrics[0].Series(); got != `http_requests_total{code="400",method="post"}` {
+		t.Errorf("Unexpected series %s", got)
+	}
+}
+
+func TestFetchLabelMatchersAreAnded(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	// Every matcher has to match, rather than any of them
+	metrics, err := New(server.URL, mustFilter(t, nil, []string{"method=post", "code=200"})).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %d", len(metrics))
+	}
+	if got := metrics[0].Series(); got != `http_requests_total{code="200",method="post"}` {
+		t.Errorf("Unexpected series %s", got)
+	}
+}
+
+func TestFetchWithNamePatterns(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	filter, err := ParseFilter([]string{"http_*"}, []string{"*_seconds"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := New(server.URL, filter).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if len(metrics) != 4 {
+		t.Fatalf("Expected the 4 http_requests_total series, got %d", len(metrics))
+	}
+	for _, metric := range metrics {
+		if metric.Name != "http_requests_total" {
+			t.Errorf("Unexpected metric %s", metric.Name)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits bound how much a scrape may read, like the body_size_limit and
+// sample_limit of a prometheus scrape config. Zero means no limit.
+type Limits struct {
+	BodySize int64 // bytes read from each exposition
+	Samples  int   // samples kept after filtering, across the whole scrape
+}
+
+// limitBody fails reads once more than limit bytes have been read from r
+func limitBody(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &bodyLimiter{r: r, remaining: limit, limit: limit}
+}
+
+type bodyLimiter struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (l *bodyLimiter) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, fmt.Errorf("body exceeds the limit of %d bytes", l.limit)
+	}
+	return n, err
+}
+
+// sampleCounter enforces the sample limit of a scrape. A nil counter has no limit.
+type sampleCounter struct {
+	limit int
+	count int
+}
+
+func newSampleCounter(limit int) *sampleCounter {
+	if limit <= 0 {
+		return nil
+	}
+	return &sampleCounter{limit: limit}
+}
+
+// add counts n more samples, failing if that exceeds the limit
+func (c *sampleCounter) add(n int) error {
+	if c == nil {
+		return nil
+	}
+	c.count += n
+	if c.count > c.limit {
+		return fmt.Errorf("sample limit of %d exceeded", c.limit)
+	}
+	return nil
+}
+
+// textFilter reads an exposition in the prometheus text format line by line,
+// passing on only the metadata and samples of selected series. expfmt parses
+// the kept lines as they are read, so large expositions are never held in
+// memory in full. Lines that can't be parsed are kept for expfmt to report.
+type textFilter struct {
+	scanner    *bufio.Scanner
+	filter     *Filter
+	samples    *sampleCounter
+	usesLabels bool
+	types      map[string]string // family name to type, from TYPE lines
+
+	// Samples of a family are consecutive, so the family of the previous
+	// sample is remembered rather than looked up again
+	lastName       []byte
+	family, label  string
+	familySelected bool
+
+	line    []byte // the last kept line
+	pending []byte // the part of line not read yet
+	err     error  // returned once the pending line is read
+}
+
+func newTextFilter(r io.Reader, filter *Filter, samples *sampleCounter) *textFilter {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &textFilter{
+		scanner:    scanner,
+		filter:     filter,
+		samples:    samples,
+		usesLabels: filter.usesLabels(),
+		types:      make(map[string]string),
+	}
+}
+
+func (f *textFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		if !f.scanner.Scan() {
+			f.err = f.scanner.Err()
+			if f.err == nil {
+				f.err = io.EOF
+			}
+			continue
+		}
+		line := f.scanner.Bytes()
+		keep, err := f.keep(line)
+		if err != nil {
+			f.err = err
+			continue
+		}
+		if keep {
+			f.line = append(append(f.line[:0], line...), '\n')
+			f.pending = f.line
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// keep reports whether a line is kept, counting the samples kept
+func (f *textFilter) keep(line []byte) (bool, error) {
+	trimmed := bytes.TrimLeft(line, " \t")
+	switch {
+	case len(trimmed) == 0:
+		return false, nil
+	case trimmed[0] == '#':
+		fields := strings.Fields(string(trimmed[1:]))
+		if len(fields) < 2 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+			return false, nil // other comments are ignored by the format
+		}
+		if fields[0] == "TYPE" && len(fields) > 2 {
+			f.types[fields[1]] = strings.ToLower(fields[2])
+			f.lastName = nil // the type may change the family of the next sample
+		}
+		return f.filter.MatchesName(fields[1]), nil
+	}
+
+	end := 0
+	for end < len(trimmed) && isNameChar(trimmed[end], end == 0) {
+		end++
+	}
+	if end == 0 && trimmed[0] == '{' {
+		// A sample without a name continues the last family, unless its
+		// labels hold a quoted name or the last name isn't known
+		if _, err := parseTextLabels(string(trimmed)); err != nil || f.lastName == nil {
+			return true, nil
+		}
+	} else if end == 0 || (end < len(trimmed) && trimmed[end] != '{' && trimmed[end] != ' ' && trimmed[end] != '\t') {
+		return true, nil // the name can't be parsed, so leave expfmt to report it
+	} else if f.lastName == nil || !bytes.Equal(trimmed[:end], f.lastName) {
+		f.lastName = append(f.lastName[:0], trimmed[:end]...)
+		f.family, f.label = textFamily(string(f.lastName), f.types)
+		f.familySelected = f.filter.MatchesName(f.family)
+	}
+	if !f.familySelected {
+		return false, nil
+	}
+	if f.usesLabels {
+		labels, err := parseTextLabels(string(trimmed[end:]))
+		if err == nil {
+			delete(labels, f.label)
+			if !f.filter.Matches(f.family, labels) {
+				return false, nil
+			}
+		}
+	}
+	if err := f.samples.add(1); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// textFamily returns the family a sample belongs to, given the types declared
+// so far, along with the label that splits the family's series into samples,
+// such as le for histogram buckets
+func textFamily(sampleName string, types map[string]string) (family, label string) {
+	switch types[sampleName] {
+	case "summary":
+		return sampleName, "quantile"
+	case "histogram", "gaugehistogram":
+		return sampleName, "le"
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+		base, ok := strings.CutSuffix(sampleName, suffix)
+		if !ok {
+			continue
+		}
+		switch types[base] {
+		case "summary":
+			return base, "quantile"
+		case "histogram", "gaugehistogram":
+			return base, "le"
+		}
+	}
+	return sampleName, ""
+}
+
+// parseTextLabels parses the labels at the start of the rest of a sample
+// line, {name="value",...}, which may be absent
+func parseTextLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	s, ok := strings.CutPrefix(strings.TrimLeft(s, " \t"), "{")
+	if !ok {
+		return labels, nil
+	}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, nil
+		}
+		name, rest := cutName(s, isLabelNameChar)
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at %q", s)
+		}
+		rest, ok := strings.CutPrefix(strings.TrimLeft(rest, " \t"), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected = after label %s", name)
+		}
+		rest, ok = strings.CutPrefix(strings.TrimLeft(rest, " \t"), `"`)
+		if !ok {
+			return nil, fmt.Errorf("expected quoted value for label %s", name)
+		}
+		end := -1
+		for i := 0; i < len(rest) && end < 0; i++ {
+			switch rest[i] {
+			case '\\':
+				i++ // skip the escaped character
+			case '"':
+				end = i
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated value of label %s", name)
+		}
+		value, err := unescapeOM(rest[:end])
+		if err != nil {
+			return nil, err
+		}
+		labels[name] = value
+		s = strings.TrimLeft(rest[end+1:], " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
@@ -0,0 +1,208 @@
+package fetcher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestTextFilter(t *testing.T) {
+	filter, err := ParseFilter(
+		[]string{`http_requests_total{code="200"}`, `http_request_duration_seconds`, `rpc_duration_seconds{quantile="0.5"}`},
+		nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := io.ReadAll(newTextFilter(strings.NewReader(mockMetricsData), filter, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(kept)
+
+	// Histogram buckets are kept despite their le label, and summaries are
+	// matched on their own labels rather than quantile, so none are kept
+	for _, expected := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="post",code="200"} 1027`,
+		`http_requests_total{method="get",code="200"} 1027`,
+		`http_request_duration_seconds_bucket{le="+Inf"} 134335`,
+		"http_request_duration_seconds_count 134335",
+	} {
+		if !strings.Contains(output, expected+"\n") {
+			t.Errorf("Expected %q to be kept, got:\n%s", expected, output)
+		}
+	}
+	for _, unexpected := range []string{`code="400"`, "rpc_duration_seconds{", "process_cpu_seconds_total", "go_memstats"} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("Expected %q to be dropped, got:\n%s", unexpected, output)
+		}
+	}
+
+	// The kept lines are still a valid exposition
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(kept))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(families["http_requests_total"].GetMetric()); got != 2 {
+		t.Errorf("Expected 2 http_requests_total series, got %d", got)
+	}
+
+	// Lines whose name can't be parsed are kept, so a malformed exposition
+	// is still an error when filtering
+	for _, line := range []string{"-bad 1", "process-cpu 1", `{code="200" 1`} {
+		kept, err := io.ReadAll(newTextFilter(strings.NewReader(mockMetricsData+line+"\n"), filter, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(kept), line+"\n") {
+			t.Errorf("Expected %q to be kept, got:\n%s", line, kept)
+		}
+		parser := expfmt.TextParser{}
+		if _, err := parser.TextToMetricFamilies(bytes.NewReader(kept)); err == nil {
+			t.Errorf("Expected %q to be reported as an error", line)
+		}
+	}
+
+	// A sample without a name continues the last family
+	kept, err = io.ReadAll(newTextFilter(strings.NewReader(
+		"http_requests_total{code=\"200\"} 1\n{code=\"400\"} 2\n{code=\"200\",method=\"get\"} 3\n"), filter, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http_requests_total{code=\"200\"} 1\n{code=\"200\",method=\"get\"} 3\n"; string(kept) != expected {
+		t.Errorf("Expected %q, got %q", expected, kept)
+	}
+}
+
+func TestParseTextLabels(t *testing.T) {
+	labels, err := parseTextLabels(`{ path="/a \"b\"\\c", code = "200" ,} 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 2 || labels["path"] != `/a "b"\c` || labels["code"] != "200" {
+		t.Errorf("Unexpected labels %q", labels)
+	}
+
+	if labels, err := parseTextLabels(" 12.5 1700000000000"); err != nil || len(labels) != 0 {
+		t.Errorf("Expected no labels, got %q, %v", labels, err)
+	}
+	for _, input := range []string{`{code}`, `{code=200}`, `{code="200}`, `{="a"}`} {
+		if _, err := parseTextLabels(input); err == nil {
+			t.Errorf("parseTextLabels(%q): expected an error", input)
+		}
+	}
+}
+
+func TestFetchLimits(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		filter   *Filter
+		limits   Limits
+		expected string // error, or empty for success
+	}{
+		{"body within limit", nil, Limits{BodySize: int64(len(mockMetricsData))}, ""},
+		{"body over limit", nil, Limits{BodySize: int64(len(mockMetricsData)) - 1}, "body exceeds the limit"},
+		{"samples over limit", nil, Limits{Samples: 10}, "sample limit of 10 exceeded"},
+		// Only the samples left after filtering count
+		{"filtered samples within limit", mustFilter(t, []string{"http_requests_total"}, nil), Limits{Samples: 4}, ""},
+		{"filtered samples over limit", mustFilter(t, []string{"http_requests_total"}, nil), Limits{Samples: 3}, "sample limit of 3 exceeded"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := New(server.URL, tc.filter)
+			f.SetLimits(tc.limits)
+			_, err := f.Fetch()
+			switch {
+			case tc.expected == "" && err != nil:
+				t.Errorf("Expected success, got %v", err)
+			case tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)):
+				t.Errorf("Expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestFetchSampleLimitOpenMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		fmt.Fprint(w, mockOpenMetricsData)
+	}))
+	defer server.Close()
+
+	f := New(server.URL, mustFilter(t, []string{"http_requests_total"}, []string{"method=post"}))
+	f.SetLimits(Limits{Samples: 1})
+	if _, err := f.Fetch(); err == nil || !strings.Contains(err.Error(), "sample limit of 1 exceeded") {
+		t.Errorf("Expected the sample limit to be exceeded, got %v", err)
+	}
+
+	// The created timestamp is a sample of its own, as in prometheus
+	f.SetLimits(Limits{Samples: 2})
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 {
+		t.Errorf("Expected 1 metric, got %d", len(metrics))
+	}
+}
+
+// largeExposition builds an exposition with the given number of series in
+// each of a few families, like a kube-state-metrics instance
+func largeExposition(series int) []byte {
+	var buf bytes.Buffer
+	for _, family := range []string{"kube_pod_info", "kube_pod_status_phase", "kube_pod_container_status_restarts_total"} {
+		fmt.Fprintf(&buf, "# HELP %s Information about pods.\n# TYPE %s gauge\n", family, family)
+		for i := 0; i < series; i++ {
+			fmt.Fprintf(&buf, "%s{namespace=\"ns-%d\",pod=\"pod-%d\",uid=\"%08x\"} %d\n", family, i%100, i, i, i)
+		}
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeText(b *testing.B) {
+	body := largeExposition(100000)
+	filter := &Filter{Selectors: []Selector{{Name: "kube_pod_status_phase"}}}
+
+	// The full exposition is parsed by expfmt, then filtered
+	b.Run("expfmt", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			parser := expfmt.TextParser{}
+			families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for name, family := range families {
+				if filter.MatchesName(name) {
+					convertFamily(family)
+				}
+			}
+		}
+	})
+
+	// Unselected lines are dropped while reading
+	b.Run("filtered", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			families, err := decodeMetricFamilies(bytes.NewReader(body), "", filter, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, family := range families {
+				convertFamily(family)
+			}
+		}
+	})
+}
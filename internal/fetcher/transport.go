@@ -0,0 +1,199 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Targets are scraped in two layers: a transport retrieves the raw
+// expositions of a target, which the fetcher then decodes and filters the
+// same way whatever the transport.
+
+// exposition is one exposition of metrics read from a target
+type exposition struct {
+	name        string // where the exposition was read from, for errors
+	body        io.ReadCloser
+	contentType string // may be empty for the prometheus text format
+}
+
+// transport retrieves the expositions of a target. HTTP targets have a
+// single exposition, file targets one per matching file.
+type transport interface {
+	open(ctx context.Context) ([]exposition, error)
+}
+
+// newTransport picks the transport for a target:
+//   - unix:///path/to.sock:/metrics scrapes over HTTP on a unix socket,
+//     with the path defaulting to /metrics
+//   - file:///path/*.prom reads every text format file matching a glob
+//   - - reads standard input
+//   - exec:command runs command with sh -c and reads its output
+//   - anything else is an HTTP or HTTPS URL
+func newTransport(target string) transport {
+	switch {
+	case target == "-":
+		return &stdinTransport{r: os.Stdin}
+	case strings.HasPrefix(target, "exec:"):
+		return execTransport{command: strings.TrimPrefix(target, "exec:")}
+	case strings.HasPrefix(target, "file://"):
+		return fileTransport{pattern: strings.TrimPrefix(target, "file://")}
+	case strings.HasPrefix(target, "unix://"):
+		socket, path, ok := strings.Cut(strings.TrimPrefix(target, "unix://"), ":")
+		if !ok || path == "" {
+			path = "/metrics"
+		}
+		// The host is only used for the Host header
+		return &httpTransport{
+			url:    "http://localhost" + path,
+			socket: socket,
+			client: &http.Client{Transport: newHTTPTransport(socket)},
+		}
+	default:
+		return &httpTransport{url: target, client: &http.Client{Transport: newHTTPTransport("")}}
+	}
+}
+
+// httpTransport scrapes a target over HTTP, like prometheus does
+type httpTransport struct {
+	url     string
+	socket  string // unix socket to connect to instead of the URL's host, if set
+	client  *http.Client
+	timeout time.Duration // sent to the target, if set
+}
+
+// newHTTPTransport creates an http.Transport with the default settings,
+// connecting to socket if it is set
+func newHTTPTransport(socket string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	return transport
+}
+
+// acceptHeader is the Accept header prometheus sends when scraping,
+// preferring protobuf, then OpenMetrics, then the classic text format
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.5,` +
+	`application/openmetrics-text;version=1.0.0;q=0.4,application/openmetrics-text;version=0.0.1;q=0.3,` +
+	`text/plain;version=0.0.4;q=0.2,*/*;q=0.1`
+
+func (t *httpTransport) open(ctx context.Context) ([]exposition, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", t.url, err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	if t.timeout > 0 {
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(t.timeout.Seconds(), 'f', -1, 64))
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metrics from %s: %w", t.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("received non-200 status code %d from %s", resp.StatusCode, t.url)
+	}
+	return []exposition{{name: t.url, body: resp.Body, contentType: resp.Header.Get("Content-Type")}}, nil
+}
+
+// fileTransport reads files in the text format, such as the .prom files of
+// node_exporter's textfile collector
+type fileTransport struct {
+	pattern string
+}
+
+func (t fileTransport) open(ctx context.Context) ([]exposition, error) {
+	files, err := filepath.Glob(t.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file pattern %s: %w", t.pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", t.pattern)
+	}
+
+	var expositions []exposition
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			closeExpositions(expositions)
+			return nil, fmt.Errorf("failed to read metrics: %w", err)
+		}
+		expositions = append(expositions, exposition{name: file, body: f})
+	}
+	return expositions, nil
+}
+
+// stdinTransport reads an exposition from standard input. Standard input
+// can only be read once, so later scrapes see the same exposition again.
+type stdinTransport struct {
+	r io.Reader
+
+	mu   sync.Mutex
+	data []byte
+	err  error
+	read bool
+}
+
+func (t *stdinTransport) open(ctx context.Context) ([]exposition, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.read {
+		t.data, t.err = io.ReadAll(t.r)
+		t.read = true
+	}
+	if t.err != nil {
+		return nil, fmt.Errorf("failed to read metrics from standard input: %w", t.err)
+	}
+	return []exposition{{name: "standard input", body: io.NopCloser(bytes.NewReader(t.data))}}, nil
+}
+
+// execTransport runs a command that prints an exposition in the text format
+type execTransport struct {
+	command string
+}
+
+// maxStderr caps how much of a failed command's stderr is reported
+const maxStderr = 1024
+
+func (t execTransport) open(ctx context.Context) ([]exposition, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever for children of a killed shell that still hold its output open
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = "…" + msg[len(msg)-maxStderr:]
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("command %q failed: %w", t.command, err)
+		}
+		return nil, fmt.Errorf("command %q failed: %w: %s", t.command, err, msg)
+	}
+	return []exposition{{name: t.command, body: io.NopCloser(&stdout)}}, nil
+}
+
+// closeExpositions closes the body of every exposition
+func closeExpositions(expositions []exposition) {
+	for _, e := range expositions {
+		e.body.Close()
+	}
+}
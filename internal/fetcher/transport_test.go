@@ -0,0 +1,137 @@
+package fetcher
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	var path string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, mockMetricsData)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	f := New("unix://"+socket+":/custom/metrics", mustFilter(t, []string{"http_requests_total"}, nil))
+	metrics, err := f.Fetch()
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if path != "/custom/metrics" {
+		t.Errorf("Expected a request for /custom/metrics, got %s", path)
+	}
+	if len(metrics) != 4 || metrics[0].Source != "unix://"+socket+":/custom/metrics" {
+		t.Errorf("Expected 4 metrics from the socket, got %+v", metrics)
+	}
+
+	// The path defaults to /metrics, and auth settings apply to sockets too
+	f = New("unix://"+socket, nil)
+	if err := f.Configure(ClientConfig{Headers: map[string]string{"X-Test": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(); err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	if path != "/metrics" {
+		t.Errorf("Expected a request for /metrics, got %s", path)
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeAt := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeAt("backup.prom", `# HELP job_last_success_seconds Last successful run.
+# TYPE job_last_success_seconds gauge
+job_last_success_seconds{job="backup"} 1700000000
+`)
+	writeAt("cleanup.prom", `# HELP job_last_success_seconds Last successful run.
+# TYPE job_last_success_seconds gauge
+job_last_success_seconds{job="cleanup"} 1700000500
+`)
+	writeAt("notes.txt", "not metrics")
+
+	metrics, err := New("file://"+filepath.Join(dir, "*.prom"), nil).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to read files: %v", err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("Expected a series from each file, got %d", len(metrics))
+	}
+
+	_, err = New("file://"+filepath.Join(dir, "*.missing"), nil).Fetch()
+	if err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("Expected an error for a glob matching nothing, got %v", err)
+	}
+
+	writeAt("conflict.prom", "# TYPE job_last_success_seconds counter\njob_last_success_seconds 1\n")
+	_, err = New("file://"+filepath.Join(dir, "*.prom"), nil).Fetch()
+	if err == nil || !strings.Contains(err.Error(), "conflict.prom") {
+		t.Errorf("Expected an error naming the file with a conflicting type, got %v", err)
+	}
+}
+
+func TestFetchStdin(t *testing.T) {
+	f := New("-", nil)
+	f.transport = &stdinTransport{r: strings.NewReader(mockMetricsData)}
+
+	// Standard input is read once, and served again on later scrapes
+	for i := 0; i < 2; i++ {
+		metrics, err := f.Fetch()
+		if err != nil {
+			t.Fatalf("Failed to read standard input: %v", err)
+		}
+		if len(metrics) == 0 || metrics[0].Source != "-" {
+			t.Errorf("Expected metrics from standard input, got %+v", metrics)
+		}
+	}
+}
+
+func TestFetchExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	script := writeFile(t, "metrics.prom", mockMetricsData)
+
+	metrics, err := New("exec:cat "+script, mustFilter(t, []string{"http_requests_total"}, nil)).Fetch()
+	if err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	if len(metrics) != 4 {
+		t.Errorf("Expected 4 series from the command's output, got %d", len(metrics))
+	}
+
+	_, err = New("exec:echo 'database is locked' >&2; exit 3", nil).Fetch()
+	if err == nil {
+		t.Fatal("Expected a non-zero exit status to fail the scrape")
+	}
+	if !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "database is locked") {
+		t.Errorf("Expected the exit status and stderr in the error, got %q", err)
+	}
+
+	f := New("exec:sleep 10", nil)
+	f.SetTimeout(50 * time.Millisecond)
+	if _, err := f.Fetch(); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a slow command to time out, got %v", err)
+	}
+}
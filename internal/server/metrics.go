@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// targetHealth tracks how scrapes of a single target are going
+type targetHealth struct {
+	up       bool
+	duration time.Duration // duration of the last scrape
+	samples  int           // samples returned by the last successful scrape
+	failures uint64        // total failed scrapes
+	scrapes  uint64        // total scrapes
+}
+
+// windowStat is a statistic re-exported for every buffered series
+type windowStat struct {
+	name string
+	help string
+	fn   func(ser *series) (float64, bool)
+}
+
+var windowStats = []windowStat{
+	{"hrmm_window_min", "Minimum of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.Min() }},
+	{"hrmm_window_max", "Maximum of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.Max() }},
+	{"hrmm_window_avg", "Average of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.Avg() }},
+	{"hrmm_window_median", "Median of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.Median() }},
+	{"hrmm_window_p95", "95th percentile of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.Percentile(95) }},
+	{"hrmm_window_stddev", "Standard deviation of the buffered samples.", func(ser *series) (float64, bool) { return ser.samples.StdDev() }},
+	{"hrmm_window_rate", "Per-second rate of change across the buffered samples, treating decreases of counters as resets.", func(ser *series) (float64, bool) { return ser.rate() }},
+	{"hrmm_window_samples", "Number of buffered samples.", func(ser *series) (float64, bool) { return float64(len(ser.samples.Values())), true }},
+}
+
+// recordHealth updates the scrape health of a target
+func (s *Server) recordHealth(target string, duration time.Duration, samples int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health, ok := s.health[target]
+	if !ok {
+		health = &targetHealth{}
+		s.health[target] = health
+	}
+	health.scrapes++
+	health.duration = duration
+	health.up = err == nil
+	if err != nil {
+		health.failures++
+	} else {
+		health.samples = samples
+	}
+}
+
+// handleMetrics exposes window statistics for every series, plus hrmm's own
+// scrape health, in the prometheus exposition format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	families := append(s.windowFamilies(), s.healthFamilies()...)
+	s.mu.RUnlock()
+
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	encoder := expfmt.NewEncoder(w, format)
+	for _, family := range families {
+		if len(family.Metric) == 0 {
+			continue
+		}
+		if err := encoder.Encode(family); err != nil {
+			return
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
+
+// windowFamilies builds one gauge family per window statistic. Each series
+// keeps its original labels, plus metric and target labels naming where it
+// came from. Must be called with s.mu held.
+func (s *Server) windowFamilies() []*dto.MetricFamily {
+	ids := make([]string, 0, len(s.series))
+	for id := range s.series {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var families []*dto.MetricFamily
+	for _, stat := range windowStats {
+		family := newFamily(stat.name, stat.help, dto.MetricType_GAUGE)
+		for _, id := range ids {
+			ser := s.series[id]
+			if len(ser.samples.Values()) == 0 {
+				// Only gaps, with no value to summarise
+				continue
+			}
+			value, ok := stat.fn(ser)
+			if !ok {
+				continue
+			}
+			labels := map[string]string{}
+			for k, v := range ser.metric.Labels {
+				labels[k] = v
+			}
+			// Preserve conflicting original labels the way prometheus does
+			for _, name := range []string{"metric", "target"} {
+				if v, exists := labels[name]; exists {
+					labels["exported_"+name] = v
+				}
+			}
+			labels["metric"] = ser.metric.Name
+			labels["target"] = ser.target
+			family.Metric = append(family.Metric, &dto.Metric{
+				Label: labelPairs(labels),
+				Gauge: &dto.Gauge{Value: &value},
+			})
+		}
+		families = append(families, family)
+	}
+	return families
+}
+
+// healthFamilies reports hrmm's own scrape health per target.
+// Must be called with s.mu held.
+func (s *Server) healthFamilies() []*dto.MetricFamily {
+	targets := make([]string, 0, len(s.health))
+	for target := range s.health {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	up := newFamily("hrmm_scrape_up", "Whether the last scrape of the target succeeded.", dto.MetricType_GAUGE)
+	duration := newFamily("hrmm_scrape_duration_seconds", "Duration of the last scrape of the target.", dto.MetricType_GAUGE)
+	samples := newFamily("hrmm_scrape_samples", "Number of samples returned by the last successful scrape of the target.", dto.MetricType_GAUGE)
+	scrapes := newFamily("hrmm_scrapes_total", "Total number of scrapes of the target.", dto.MetricType_COUNTER)
+	failures := newFamily("hrmm_scrape_failures_total", "Total number of failed scrapes of the target.", dto.MetricType_COUNTER)
+
+	for _, target := range targets {
+		health := s.health[target]
+		labels := labelPairs(map[string]string{"target": target})
+
+		upValue := 0.0
+		if health.up {
+			upValue = 1
+		}
+		durationValue := health.duration.Seconds()
+		samplesValue := float64(health.samples)
+		scrapesValue := float64(health.scrapes)
+		failuresValue := float64(health.failures)
+
+		up.Metric = append(up.Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: &upValue}})
+		duration.Metric = append(duration.Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: &durationValue}})
+		samples.Metric = append(samples.Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: &samplesValue}})
+		scrapes.Metric = append(scrapes.Metric, &dto.Metric{Label: labels, Counter: &dto.Counter{Value: &scrapesValue}})
+		failures.Metric = append(failures.Metric, &dto.Metric{Label: labels, Counter: &dto.Counter{Value: &failuresValue}})
+	}
+	return []*dto.MetricFamily{up, duration, samples, scrapes, failures}
+}
+
+func newFamily(name, help string, metricType dto.MetricType) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: &name,
+		Help: &help,
+		Type: metricType.Enum(),
+	}
+}
+
+// labelPairs converts a label map into label pairs sorted by name
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]*dto.LabelPair, len(names))
+	for i, name := range names {
+		value := labels[name]
+		pairs[i] = &dto.LabelPair{Name: &name, Value: &value}
+	}
+	return pairs
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrapeMetrics fetches /metrics from the server and parses the text output
+func scrapeMetrics(t *testing.T, s *Server) map[string]*dto.MetricFamily {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected text format, got %q", ct)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to parse /metrics output: %v\n%s", err, rec.Body.String())
+	}
+	return families
+}
+
+// findMetric returns the metric in the family with all the given labels
+func findMetric(family *dto.MetricFamily, labels map[string]string) *dto.Metric {
+	for _, metric := range family.GetMetric() {
+		matched := 0
+		for _, pair := range metric.GetLabel() {
+			if v, ok := labels[pair.GetName()]; ok && v == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return metric
+		}
+	}
+	return nil
+}
+
+func TestMetrics_WindowStats(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+
+	f := fetcher.New(target.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	fakeClock(s)
+	for i := 0; i < 3; i++ {
+		s.scrape(context.Background(), f)
+	}
+
+	families := scrapeMetrics(t, s)
+	labels := map[string]string{
+		"metric": "http_requests_total",
+		"target": target.URL,
+		"code":   "200",
+		"method": "post",
+	}
+
+	tests := map[string]float64{
+		"hrmm_window_min":     10,
+		"hrmm_window_max":     30,
+		"hrmm_window_avg":     20,
+		"hrmm_window_median":  20,
+		"hrmm_window_p95":     30,
+		"hrmm_window_rate":    10,
+		"hrmm_window_samples": 3,
+	}
+	for name, expected := range tests {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("expected family %s", name)
+			continue
+		}
+		if family.GetType() != dto.MetricType_GAUGE {
+			t.Errorf("%s: expected gauge, got %s", name, family.GetType())
+		}
+		metric := findMetric(family, labels)
+		if metric == nil {
+			t.Errorf("%s: no series with labels %v", name, labels)
+			continue
+		}
+		if got := metric.GetGauge().GetValue(); got != expected {
+			t.Errorf("%s: expected %f, got %f", name, expected, got)
+		}
+	}
+
+	if _, ok := families["hrmm_window_stddev"]; !ok {
+		t.Error("expected hrmm_window_stddev family")
+	}
+}
+
+func TestMetrics_ConflictingLabelsAreExported(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	s.record("http://example", []fetcher.MetricData{
+		{Name: "jobs", Labels: map[string]string{"metric": "orig", "target": "db"}, Value: 1},
+	}, time.Now())
+
+	families := scrapeMetrics(t, s)
+	metric := findMetric(families["hrmm_window_max"], map[string]string{
+		"metric":          "jobs",
+		"target":          "http://example",
+		"exported_metric": "orig",
+		"exported_target": "db",
+	})
+	if metric == nil {
+		t.Errorf("expected original labels to be kept as exported_*, got %v", families["hrmm_window_max"])
+	}
+}
+
+func TestMetrics_ScrapeHealth(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	good := fetcher.New(target.URL, nil)
+	bad := fetcher.New(dead.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{good, bad}, time.Second, 10)
+	s.scrape(context.Background(), good)
+	s.scrape(context.Background(), bad)
+	s.scrape(context.Background(), bad)
+
+	families := scrapeMetrics(t, s)
+
+	checks := []struct {
+		family string
+		target string
+		value  float64
+	}{
+		{"hrmm_scrape_up", target.URL, 1},
+		{"hrmm_scrape_up", dead.URL, 0},
+		{"hrmm_scrape_samples", target.URL, 3},
+		{"hrmm_scrapes_total", dead.URL, 2},
+		{"hrmm_scrape_failures_total", target.URL, 0},
+		{"hrmm_scrape_failures_total", dead.URL, 2},
+	}
+	for _, check := range checks {
+		metric := findMetric(families[check.family], map[string]string{"target": check.target})
+		if metric == nil {
+			t.Errorf("%s: no series for target %s", check.family, check.target)
+			continue
+		}
+		got := metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+		if got != check.value {
+			t.Errorf("%s{target=%q}: expected %f, got %f", check.family, check.target, check.value, got)
+		}
+	}
+
+	metric := findMetric(families["hrmm_scrape_duration_seconds"], map[string]string{"target": target.URL})
+	if metric == nil || metric.GetGauge().GetValue() <= 0 {
+		t.Errorf("expected a positive scrape duration, got %v", metric)
+	}
+}
+
+func TestMetrics_OpenMetricsNegotiation(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	s.record("http://example", []fetcher.MetricData{{Name: "jobs", Value: 1}}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("expected openmetrics content type, got %q", ct)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "# EOF\n") {
+		t.Errorf("expected openmetrics output to end with # EOF, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetrics_CounterResets(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	start := time.Unix(1700000000, 0)
+	for i, value := range []float64{10, 20, 5} {
+		at := start.Add(time.Duration(i) * time.Second)
+		s.record("http://a", []fetcher.MetricData{
+			{Name: "requests_total", Type: "COUNTER", Value: fetcher.NullableFloat64(value)},
+			{Name: "temperature", Type: "GAUGE", Value: fetcher.NullableFloat64(value)},
+		}, at)
+	}
+
+	// The counter increased by 10, then by 5 after restarting from zero,
+	// while the gauge is rated from its first and last values
+	families := scrapeMetrics(t, s)
+	for metric, expected := range map[string]float64{"requests_total": 7.5, "temperature": -2.5} {
+		rate := findMetric(families["hrmm_window_rate"], map[string]string{"metric": metric})
+		if rate == nil || rate.GetGauge().GetValue() != expected {
+			t.Errorf("%s: expected a rate of %g, got %v", metric, expected, rate)
+		}
+	}
+}
+
+func TestMetrics_SkipsSeriesWithoutValues(t *testing.T) {
+	s := New(nil, time.Second, 1)
+	s.record("http://a", []fetcher.MetricData{{Name: "up", Type: "GAUGE", Value: 1}}, time.Unix(1700000000, 0))
+	s.recordGap("http://a", time.Unix(1700000001, 0))
+
+	// The only sample left is a gap
+	for name, family := range scrapeMetrics(t, s) {
+		if strings.HasPrefix(name, "hrmm_window_") && findMetric(family, map[string]string{"metric": "up"}) != nil {
+			t.Errorf("expected no %s for a series without values", name)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/buffer"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// Server polls prometheus endpoints into in-memory ring buffers and serves
+// the collected series over a JSON HTTP API.
+type Server struct {
+	fetchers []*fetcher.MetricsFetcher
+	interval time.Duration
+	capacity int
+	now      func() time.Time // clock used to timestamp scrapes
+
+	mu          sync.RWMutex
+	series      map[string]*series
+	health      map[string]*targetHealth
+	subscribers map[*subscriber]struct{}
+}
+
+// series holds the recent history of a single time series
+type series struct {
+	id      string
+	target  string
+	metric  fetcher.MetricData        // most recent scrape, used for metadata
+	family  string                    // name of the histogram or summary the series is part of, or its own
+	samples *buffer.TimestampedBuffer // scraped values, with gaps for failed scrapes
+	missed  int                       // scrapes of the target since the series was last seen
+}
+
+// seriesInfo describes a series in the /api/series listing
+type seriesInfo struct {
+	ID     string            `json:"id"`
+	Target string            `json:"target"`
+	Name   string            `json:"name"`
+	Type   string            `json:"type,omitempty"`
+	Help   string            `json:"help,omitempty"`
+	Labels map[string]string `json:"labels"`
+}
+
+// sample is a single timestamped value. A null value is a failed scrape.
+type sample struct {
+	Timestamp time.Time               `json:"timestamp"`
+	Value     fetcher.NullableFloat64 `json:"value"`
+}
+
+// stats summarises the values currently held in a series' buffer.
+// Fields are omitted when there is not enough data to compute them.
+type stats struct {
+	Latest *float64 `json:"latest,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Avg    *float64 `json:"avg,omitempty"`
+	Median *float64 `json:"median,omitempty"`
+	P95    *float64 `json:"p95,omitempty"`
+	StdDev *float64 `json:"stddev,omitempty"`
+	CV     *float64 `json:"cv,omitempty"`
+	Rate   *float64 `json:"rate,omitempty"`
+	Trend  int      `json:"trend"`
+}
+
+// seriesDetail is the response for /api/series/{id}
+type seriesDetail struct {
+	seriesInfo
+	Samples []sample `json:"samples"`
+	Stats   stats    `json:"stats"`
+}
+
+// New creates a Server polling each fetcher every interval and keeping
+// the last capacity samples of every series.
+func New(fetchers []*fetcher.MetricsFetcher, interval time.Duration, capacity int) *Server {
+	return &Server{
+		fetchers:    fetchers,
+		interval:    interval,
+		capacity:    capacity,
+		now:         time.Now,
+		series:      make(map[string]*series),
+		health:      make(map[string]*targetHealth),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Run polls all targets until the context is cancelled
+func (s *Server) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, f := range s.fetchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.poll(ctx, f)
+		}()
+	}
+	wg.Wait()
+}
+
+// poll scrapes a single target immediately and then on every interval
+func (s *Server) poll(ctx context.Context, f *fetcher.MetricsFetcher) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.scrape(ctx, f)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrape fetches a target once and records the results. Scrapes cancelled
+// by shutting down aren't recorded.
+func (s *Server) scrape(ctx context.Context, f *fetcher.MetricsFetcher) {
+	start := time.Now()
+	data, err := f.FetchContext(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	s.recordHealth(f.URL(), time.Since(start), len(data), err)
+	if err != nil {
+		log.Printf("Error fetching metrics from %s: %v", f.URL(), err)
+		s.recordGap(f.URL(), s.now())
+		return
+	}
+	s.record(f.URL(), data, s.now())
+}
+
+// record pushes one scrape's worth of data from a target into the buffers
+// and publishes it to stream subscribers
+func (s *Server) record(target string, data []fetcher.MetricData, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]streamEvent, 0, len(data))
+	seen := make(map[string]bool)
+	for _, scraped := range data {
+		for _, metric := range scalarSeries(scraped) {
+			value := float64(metric.Value)
+			// Skip NaN/Inf values
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			metric.Source = target
+			id := metric.Identifier()
+			ser, ok := s.series[id]
+			if !ok {
+				ser = &series{
+					id:      id,
+					target:  target,
+					family:  scraped.Name,
+					samples: buffer.NewTimestamped(s.capacity),
+				}
+				s.series[id] = ser
+			}
+			ser.metric = metric
+			ser.missed = 0
+			seen[id] = true
+			ser.samples.Push(ts, value)
+			events = append(events, streamEvent{
+				ID:         id,
+				Target:     target,
+				Timestamp:  ts.UTC(),
+				MetricData: metric,
+				family:     scraped.Name,
+			})
+		}
+	}
+	s.prune(target, seen)
+	s.publish(events)
+}
+
+// scalarSeries splits a metric into the series with a single value that can
+// be buffered. Histograms and summaries become a series for each of their
+// _count, _sum and quantiles, which are typed as counters and gauges, while
+// their buckets are left out.
+func scalarSeries(metric fetcher.MetricData) []fetcher.MetricData {
+	metricType := strings.ToUpper(metric.Type)
+	if metricType != "HISTOGRAM" && metricType != "GAUGE_HISTOGRAM" && metricType != "SUMMARY" {
+		return []fetcher.MetricData{metric}
+	}
+	var result []fetcher.MetricData
+	for _, sample := range metric.Samples() {
+		if sample.Name == metric.Name+"_bucket" {
+			continue
+		}
+		sampleType := "GAUGE"
+		if metricType != "GAUGE_HISTOGRAM" && sample.Name != metric.Name {
+			sampleType = "COUNTER"
+		}
+		result = append(result, fetcher.MetricData{
+			Name:   sample.Name,
+			Help:   metric.Help,
+			Type:   sampleType,
+			Labels: sample.Labels,
+			Value:  fetcher.NullableFloat64(sample.Value),
+		})
+	}
+	return result
+}
+
+// recordGap marks a failed scrape in the buffers of every series of a
+// target, and publishes the gaps to stream subscribers
+func (s *Server) recordGap(target string, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []streamEvent
+	for _, ser := range s.series {
+		if ser.target == target {
+			ser.samples.PushGap(ts)
+			events = append(events, ser.event(buffer.Sample{Time: ts, Value: math.NaN()}))
+		}
+	}
+	s.prune(target, nil)
+	s.publish(events)
+}
+
+// prune counts a scrape of a target against each of its series that wasn't
+// seen, and forgets the series that haven't been seen for a buffer's worth
+// of scrapes, so that churning label values don't grow memory forever
+func (s *Server) prune(target string, seen map[string]bool) {
+	for id, ser := range s.series {
+		if ser.target != target || seen[id] {
+			continue
+		}
+		ser.missed++
+		if ser.missed >= s.capacity {
+			delete(s.series, id)
+		}
+	}
+}
+
+// Handler returns the HTTP handler serving the JSON API, browser dashboard
+// and prometheus metrics
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /", uiHandler())
+	mux.HandleFunc("GET /api/series", s.handleSeriesList)
+	mux.HandleFunc("GET /api/series/{id}", s.handleSeries)
+	mux.HandleFunc("GET /api/stream", s.handleStream)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// handleSeriesList lists every series currently held in memory
+func (s *Server) handleSeriesList(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	list := make([]seriesInfo, 0, len(s.series))
+	for _, ser := range s.series {
+		list = append(list, ser.info())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeJSON(w, list)
+}
+
+// handleSeries returns the samples and statistics for a single series
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.mu.RLock()
+	ser, ok := s.series[id]
+	var detail seriesDetail
+	if ok {
+		detail = ser.detail()
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, "series not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (ser *series) info() seriesInfo {
+	return seriesInfo{
+		ID:     ser.id,
+		Target: ser.target,
+		Name:   ser.metric.Name,
+		Type:   ser.metric.Type,
+		Help:   ser.metric.Help,
+		Labels: ser.metric.Labels,
+	}
+}
+
+// buffered returns the buffered values paired with their scrape times,
+// including gaps
+func (ser *series) buffered() []sample {
+	buffered := ser.samples.Samples()
+	samples := make([]sample, len(buffered))
+	for i, s := range buffered {
+		samples[i] = sample{
+			Timestamp: s.Time.UTC(),
+			Value:     fetcher.NullableFloat64(s.Value),
+		}
+	}
+	return samples
+}
+
+func (ser *series) detail() seriesDetail {
+	return seriesDetail{
+		seriesInfo: ser.info(),
+		Samples:    ser.buffered(),
+		Stats:      bufferStats(ser),
+	}
+}
+
+// rate returns the per-second rate across the buffered samples. Counters
+// are rated like prometheus' rate(), with any decrease taken as a reset.
+func (ser *series) rate() (float64, bool) {
+	if strings.EqualFold(ser.metric.Type, "COUNTER") {
+		return buffer.Rate(ser.samples.Samples())
+	}
+	return ser.samples.Rate()
+}
+
+// bufferStats computes the same statistics the graph dashboard displays
+func bufferStats(ser *series) stats {
+	rb := ser.samples
+	var st stats
+	st.Latest = optional(rb.Latest())
+	st.Min = optional(rb.Min())
+	st.Max = optional(rb.Max())
+	st.Avg = optional(rb.Avg())
+	st.Median = optional(rb.Median())
+	st.P95 = optional(rb.Percentile(95))
+	st.StdDev = optional(rb.StdDev())
+	st.CV = optional(rb.CV())
+	st.Rate = optional(ser.rate())
+	st.Trend = rb.Trend()
+	return st
+}
+
+// optional converts a (value, ok) pair into a pointer that is nil when !ok
+func optional(v float64, ok bool) *float64 {
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+const mockMetricsData = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} %d
+http_requests_total{method="get",code="200"} 7
+
+# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 42
+`
+
+// targetServer serves mock metrics whose post counter increases by 10 on every scrape
+func targetServer() *httptest.Server {
+	callCount := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fmt.Fprintf(w, mockMetricsData, callCount*10)
+	}))
+}
+
+// fakeClock makes the server timestamp each scrape one second after the last
+func fakeClock(s *Server) {
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func getJSON(t *testing.T, handler http.Handler, path string, v any) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("failed to decode response from %s: %v\n%s", path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestServer_SeriesList(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+
+	f := fetcher.New(target.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	s.scrape(context.Background(), f)
+
+	var list []seriesInfo
+	if code := getJSON(t, s.Handler(), "/api/series", &list); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(list) != 3 {
+		t.Fatalf("expected 3 series, got %d: %+v", len(list), list)
+	}
+
+	expected := `go_goroutines@` + target.URL
+	if list[0].ID != expected {
+		t.Errorf("expected first series %q, got %q", expected, list[0].ID)
+	}
+	if list[0].Target != target.URL {
+		t.Errorf("expected target %q, got %q", target.URL, list[0].Target)
+	}
+	if list[0].Type != "GAUGE" {
+		t.Errorf("expected type GAUGE, got %q", list[0].Type)
+	}
+}
+
+func TestServer_SeriesDetail(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+
+	f := fetcher.New(target.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	fakeClock(s)
+	for i := 0; i < 3; i++ {
+		s.scrape(context.Background(), f)
+	}
+
+	id := `http_requests_total{code="200",method="post"}@` + target.URL
+	var detail seriesDetail
+	if code := getJSON(t, s.Handler(), "/api/series/"+url.PathEscape(id), &detail); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if detail.ID != id {
+		t.Errorf("expected id %q, got %q", id, detail.ID)
+	}
+	if detail.Help != "The total number of HTTP requests." {
+		t.Errorf("unexpected help %q", detail.Help)
+	}
+	if len(detail.Samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(detail.Samples))
+	}
+	for i, sample := range detail.Samples {
+		if float64(sample.Value) != float64((i+1)*10) {
+			t.Errorf("sample %d: expected %d, got %f", i, (i+1)*10, float64(sample.Value))
+		}
+		if sample.Timestamp.IsZero() {
+			t.Errorf("sample %d: expected a timestamp", i)
+		}
+	}
+
+	if detail.Stats.Min == nil || *detail.Stats.Min != 10 {
+		t.Errorf("expected min 10, got %v", detail.Stats.Min)
+	}
+	if detail.Stats.Max == nil || *detail.Stats.Max != 30 {
+		t.Errorf("expected max 30, got %v", detail.Stats.Max)
+	}
+	if detail.Stats.Avg == nil || *detail.Stats.Avg != 20 {
+		t.Errorf("expected avg 20, got %v", detail.Stats.Avg)
+	}
+	if detail.Stats.Rate == nil || *detail.Stats.Rate != 10 {
+		t.Errorf("expected rate 10/s, got %v", detail.Stats.Rate)
+	}
+	if detail.Stats.Trend != 1 {
+		t.Errorf("expected upward trend, got %d", detail.Stats.Trend)
+	}
+}
+
+func TestServer_FailedScrapeLeavesGap(t *testing.T) {
+	target := targetServer()
+
+	f := fetcher.New(target.URL, &fetcher.Filter{Selectors: []fetcher.Selector{{Name: "go_goroutines"}}})
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	fakeClock(s)
+	s.scrape(context.Background(), f)
+	target.Close()
+	s.scrape(context.Background(), f)
+
+	var detail seriesDetail
+	id := "go_goroutines@" + target.URL
+	if code := getJSON(t, s.Handler(), "/api/series/"+url.PathEscape(id), &detail); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(detail.Samples) != 2 {
+		t.Fatalf("expected a sample and a gap, got %+v", detail.Samples)
+	}
+	if !math.IsNaN(float64(detail.Samples[1].Value)) {
+		t.Errorf("expected the failed scrape to be a null value, got %f", float64(detail.Samples[1].Value))
+	}
+	if detail.Stats.Latest == nil || *detail.Stats.Latest != 42 {
+		t.Errorf("expected latest to skip the gap, got %v", detail.Stats.Latest)
+	}
+}
+
+func TestServer_ForgetsSeriesNotSeenForABuffer(t *testing.T) {
+	s := New(nil, time.Second, 3)
+	at := time.Now()
+	for i := 0; i < 4; i++ {
+		// Each scrape has a new series, as with a label holding a request ID
+		s.record("http://a", []fetcher.MetricData{
+			{Name: "up", Value: 1},
+			{Name: "requests", Labels: map[string]string{"id": fmt.Sprint(i)}, Value: 1},
+		}, at.Add(time.Duration(i)*time.Second))
+	}
+	s.record("http://b", []fetcher.MetricData{{Name: "up", Value: 1}}, at)
+
+	var list []seriesInfo
+	getJSON(t, s.Handler(), "/api/series", &list)
+	var ids []string
+	for _, info := range list {
+		ids = append(ids, info.ID)
+	}
+	expected := []string{`requests{id="1"}@http://a`, `requests{id="2"}@http://a`, `requests{id="3"}@http://a`, "up@http://a", "up@http://b"}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("expected series %v, got %v", expected, ids)
+	}
+
+	// A target that stays down loses its series once their buffers are gaps
+	for i := 0; i < 3; i++ {
+		s.recordGap("http://a", at.Add(time.Duration(4+i)*time.Second))
+	}
+	getJSON(t, s.Handler(), "/api/series", &list)
+	if len(list) != 1 || list[0].ID != "up@http://b" {
+		t.Errorf("expected only the other target's series, got %+v", list)
+	}
+}
+
+func TestServer_SeriesNotFound(t *testing.T) {
+	s := New(nil, time.Second, 10)
+
+	var detail seriesDetail
+	if code := getJSON(t, s.Handler(), "/api/series/nope", &detail); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+}
+
+func TestServer_BufferCapacity(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+
+	f := fetcher.New(target.URL, &fetcher.Filter{Selectors: []fetcher.Selector{{Name: "go_goroutines"}}})
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 5)
+	for i := 0; i < 8; i++ {
+		s.scrape(context.Background(), f)
+	}
+
+	var detail seriesDetail
+	id := "go_goroutines@" + target.URL
+	if code := getJSON(t, s.Handler(), "/api/series/"+url.PathEscape(id), &detail); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(detail.Samples) != 5 {
+		t.Errorf("expected buffer to hold 5 samples, got %d", len(detail.Samples))
+	}
+}
+
+func TestServer_HistogramsAndSummariesAreFlattened(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	count, sum := uint64(9), fetcher.NullableFloat64(4.5)
+	s.record("http://a", []fetcher.MetricData{
+		{Name: "lat", Type: "HISTOGRAM", SampleCount: &count, SampleSum: &sum,
+			Buckets: []fetcher.HistogramBucket{{UpperBound: 1, CumulativeCount: 9}}},
+		{Name: "s", Type: "SUMMARY", SampleCount: &count, SampleSum: &sum,
+			Quantiles: []fetcher.SummaryQuantile{{Quantile: 0.5, Value: 0.25}}},
+	}, time.Unix(1700000000, 0))
+
+	// Buckets are left out, and no series is buffered as a zero
+	expected := map[string]float64{
+		`lat_count@http://a`:         9,
+		`lat_sum@http://a`:           4.5,
+		`s_count@http://a`:           9,
+		`s_sum@http://a`:             4.5,
+		`s{quantile="0.5"}@http://a`: 0.25,
+	}
+	if len(s.series) != len(expected) {
+		t.Errorf("expected series %v, got %d series", expected, len(s.series))
+	}
+	for id, value := range expected {
+		ser, ok := s.series[id]
+		if !ok {
+			t.Errorf("missing series %s", id)
+			continue
+		}
+		if latest, _ := ser.samples.Latest(); latest != value {
+			t.Errorf("%s: expected %g, got %g", id, value, latest)
+		}
+	}
+	if got := s.series["lat_count@http://a"].metric.Type; got != "COUNTER" {
+		t.Errorf("expected the histogram count to be a counter, got %s", got)
+	}
+	if got := s.series[`s{quantile="0.5"}@http://a`].metric.Type; got != "GAUGE" {
+		t.Errorf("expected the summary quantile to be a gauge, got %s", got)
+	}
+
+	// Filtering on the family name selects its series
+	sub, backfill := s.subscribe(&fetcher.Filter{Selectors: []fetcher.Selector{{Name: "lat"}}})
+	defer s.unsubscribe(sub)
+	if len(backfill) != 2 {
+		t.Errorf("expected the histogram's 2 series in the backfill, got %+v", backfill)
+	}
+}
+
+func TestServer_CounterRateAfterReset(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	start := time.Unix(1700000000, 0)
+	for i, value := range []float64{100, 110, 4} {
+		s.record("http://a", []fetcher.MetricData{{Name: "requests_total", Type: "COUNTER", Value: fetcher.NullableFloat64(value)}},
+			start.Add(time.Duration(i)*time.Second))
+	}
+
+	var detail seriesDetail
+	if code := getJSON(t, s.Handler(), "/api/series/"+url.PathEscape("requests_total@http://a"), &detail); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	// 10 before the restart and 4 after it, over 2 seconds
+	if detail.Stats.Rate == nil || *detail.Stats.Rate != 7 {
+		t.Errorf("expected a rate of 7, got %v", detail.Stats.Rate)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/buffer"
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// subscriberBacklog is the number of scrape batches buffered for a stream
+// client before further batches are dropped for it
+const subscriberBacklog = 16
+
+// keepaliveInterval is how often an idle stream sends a comment line so
+// proxies don't close the connection
+const keepaliveInterval = 15 * time.Second
+
+// streamEvent is a single sample sent to stream clients. It is encoded like
+// fetcher.MetricData with the series id, target and scrape time added.
+type streamEvent struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`
+	Timestamp time.Time `json:"timestamp"`
+	fetcher.MetricData
+
+	family string // the family the series is part of, which filters also match
+}
+
+// subscriber is a connected stream client
+type subscriber struct {
+	filter *fetcher.Filter
+	events chan []streamEvent
+}
+
+// matches reports whether the filter selects a series, or the histogram or
+// summary family it is part of
+func (sub *subscriber) matches(metric fetcher.MetricData, family string) bool {
+	if metric.Matches(sub.filter) {
+		return true
+	}
+	metric.Name = family
+	return metric.Matches(sub.filter)
+}
+
+// subscribe registers a new stream client and returns it along with the
+// samples already buffered for matching series, oldest first. Registration
+// and the backfill snapshot happen under the same lock record uses, so the
+// client sees every sample exactly once.
+func (s *Server) subscribe(filter *fetcher.Filter) (*subscriber, []streamEvent) {
+	sub := &subscriber{
+		filter: filter,
+		events: make(chan []streamEvent, subscriberBacklog),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var backfill []streamEvent
+	for _, ser := range s.series {
+		if sub.matches(ser.metric, ser.family) {
+			backfill = append(backfill, ser.events()...)
+		}
+	}
+	s.subscribers[sub] = struct{}{}
+
+	sort.SliceStable(backfill, func(i, j int) bool {
+		return backfill[i].Timestamp.Before(backfill[j].Timestamp)
+	})
+	return sub, backfill
+}
+
+// unsubscribe removes a stream client
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// publish sends the events of one scrape to every interested subscriber.
+// Must be called with s.mu held.
+func (s *Server) publish(events []streamEvent) {
+	for sub := range s.subscribers {
+		var batch []streamEvent
+		for _, event := range events {
+			if sub.matches(event.MetricData, event.family) {
+				batch = append(batch, event)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		select {
+		case sub.events <- batch:
+		default:
+			log.Printf("Dropping %d events for slow stream client", len(batch))
+		}
+	}
+}
+
+// events converts the samples held in a series' buffer into stream events.
+// Gaps are sent with a null value, so that clients can break their lines.
+func (ser *series) events() []streamEvent {
+	var events []streamEvent
+	for _, sample := range ser.samples.Samples() {
+		events = append(events, ser.event(sample))
+	}
+	return events
+}
+
+// event converts one sample of a series into a stream event
+func (ser *series) event(sample buffer.Sample) streamEvent {
+	metric := ser.metric
+	metric.Value = fetcher.NullableFloat64(sample.Value)
+	return streamEvent{
+		ID:         ser.id,
+		Target:     ser.target,
+		Timestamp:  sample.Time.UTC(),
+		MetricData: metric,
+		family:     ser.family,
+	}
+}
+
+// handleStream streams samples to the client as Server-Sent Events. The
+// metric and label query parameters filter the stream the same way the
+// --metric and --label flags filter a scrape, and may be selectors.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := fetcher.ParseFilter(query["metric"], query["exclude_metric"], query["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub, backfill := s.subscribe(filter)
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeEvents(w, backfill); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case batch := <-sub.events:
+			if err := writeEvents(w, batch); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvents writes each event as an SSE data message
+func writeEvents(w http.ResponseWriter, events []streamEvent) error {
+	for _, event := range events {
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", jsonData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcpherrinm/hrmm/internal/fetcher"
+)
+
+// streamClient reads SSE data messages from a stream endpoint
+type streamClient struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+func connectStream(t *testing.T, url string) *streamClient {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to connect to stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+	return &streamClient{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the next data message, failing the test after a timeout
+func (c *streamClient) next(t *testing.T) streamEvent {
+	t.Helper()
+	result := make(chan streamEvent, 1)
+	go func() {
+		for c.scanner.Scan() {
+			line := c.scanner.Text()
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var event streamEvent
+				if err := json.Unmarshal([]byte(data), &event); err != nil {
+					t.Errorf("failed to decode event %q: %v", data, err)
+				}
+				result <- event
+				return
+			}
+		}
+	}()
+	select {
+	case event := <-result:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for stream event")
+		return streamEvent{}
+	}
+}
+
+func (c *streamClient) Close() {
+	c.resp.Body.Close()
+}
+
+// waitForSubscribers waits until n stream clients are registered
+func waitForSubscribers(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.RLock()
+		count := len(s.subscribers)
+		s.mu.RUnlock()
+		if count == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d subscribers", n)
+}
+
+func TestStream_BackfillThenLive(t *testing.T) {
+	target := targetServer()
+	defer target.Close()
+
+	f := fetcher.New(target.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	s.scrape(context.Background(), f)
+	s.scrape(context.Background(), f)
+
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+
+	client := connectStream(t, api.URL+"/api/stream?metric=http_requests_total&label=method=post")
+	defer client.Close()
+
+	// Backfill contains the two buffered samples
+	for i := 1; i <= 2; i++ {
+		event := client.next(t)
+		if event.Name != "http_requests_total" || event.Labels["method"] != "post" {
+			t.Errorf("unexpected backfill event %+v", event)
+		}
+		if float64(event.Value) != float64(i*10) {
+			t.Errorf("backfill %d: expected %d, got %f", i, i*10, float64(event.Value))
+		}
+		if event.Target != target.URL {
+			t.Errorf("expected target %q, got %q", target.URL, event.Target)
+		}
+	}
+
+	waitForSubscribers(t, s, 1)
+	s.scrape(context.Background(), f)
+
+	event := client.next(t)
+	if float64(event.Value) != 30 {
+		t.Errorf("expected live value 30, got %f", float64(event.Value))
+	}
+	if event.Help != "The total number of HTTP requests." || event.Type != "COUNTER" {
+		t.Errorf("expected live event to carry metric metadata, got %+v", event)
+	}
+}
+
+func TestStream_Gaps(t *testing.T) {
+	target := targetServer()
+
+	f := fetcher.New(target.URL, &fetcher.Filter{Selectors: []fetcher.Selector{{Name: "go_goroutines"}}})
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+	s.scrape(context.Background(), f)
+	target.Close()
+	s.scrape(context.Background(), f)
+
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+	client := connectStream(t, api.URL+"/api/stream")
+	defer client.Close()
+
+	// The backfill has the value, then the failed scrape as null
+	if event := client.next(t); float64(event.Value) != 42 {
+		t.Errorf("expected the scraped value, got %+v", event)
+	}
+	if event := client.next(t); !math.IsNaN(float64(event.Value)) || event.Name != "go_goroutines" {
+		t.Errorf("expected a null value for the failed scrape, got %+v", event)
+	}
+
+	// and so do live failed scrapes
+	waitForSubscribers(t, s, 1)
+	s.scrape(context.Background(), f)
+	if event := client.next(t); !math.IsNaN(float64(event.Value)) || event.Target != target.URL {
+		t.Errorf("expected a live null value, got %+v", event)
+	}
+}
+
+func TestStream_MultipleClientsShareScrapes(t *testing.T) {
+	scrapes := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapes++
+		w.Write([]byte("go_goroutines 42\n"))
+	}))
+	defer target.Close()
+
+	f := fetcher.New(target.URL, nil)
+	s := New([]*fetcher.MetricsFetcher{f}, time.Second, 10)
+
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+
+	var clients []*streamClient
+	for i := 0; i < 3; i++ {
+		client := connectStream(t, api.URL+"/api/stream")
+		defer client.Close()
+		clients = append(clients, client)
+	}
+	waitForSubscribers(t, s, 3)
+
+	s.scrape(context.Background(), f)
+	for i, client := range clients {
+		event := client.next(t)
+		if event.Name != "go_goroutines" || float64(event.Value) != 42 {
+			t.Errorf("client %d: unexpected event %+v", i, event)
+		}
+	}
+
+	if scrapes != 1 {
+		t.Errorf("expected a single scrape shared by all clients, got %d", scrapes)
+	}
+}
+
+func TestStream_UnsubscribeOnDisconnect(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+
+	client := connectStream(t, api.URL+"/api/stream")
+	waitForSubscribers(t, s, 1)
+	client.Close()
+	waitForSubscribers(t, s, 0)
+}
+
+func TestStream_InvalidSelector(t *testing.T) {
+	s := New(nil, time.Second, 10)
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/api/stream?metric=" + url.QueryEscape(`http_requests_total{code=~"("}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid selector, got %d", resp.StatusCode)
+	}
+}
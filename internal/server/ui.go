@@ -0,0 +1,22 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles holds the browser dashboard. It only references its own assets so
+// it works without internet access.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded browser dashboard
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(files)
+}
@@ -0,0 +1,487 @@
+// hrmm browser dashboard. Mirrors the flow of `hrmm graph`: pick metrics
+// from the latest scrape, then watch live charts fed by /api/stream.
+"use strict";
+
+// Number of points kept per chart
+const MAX_POINTS = 300;
+
+// Same palette the TUI uses for its charts
+const chartColors = [
+  "#00FFFF", // cyan
+  "#FF6B6B", // coral red
+  "#98FB98", // pale green
+  "#DDA0DD", // plum
+  "#FFD700", // gold
+  "#87CEEB", // sky blue
+  "#FFA07A", // light salmon
+  "#90EE90", // light green
+  "#FF69B4", // hot pink
+  "#20B2AA", // light sea green
+];
+
+const state = {
+  series: [],          // listing from /api/series
+  selected: new Set(), // selected series ids, in selection order
+  graphs: new Map(),   // series id -> graph
+  source: null,        // EventSource for the live stream
+  drawPending: false,
+};
+
+const $ = (id) => document.getElementById(id);
+
+function setStatus(text, isError = false) {
+  const status = $("status");
+  status.textContent = text;
+  status.classList.toggle("error", isError);
+}
+
+// ---- Metric picker ----
+
+async function loadSeries() {
+  try {
+    const resp = await fetch("api/series");
+    if (!resp.ok) {
+      throw new Error(`${resp.status} ${resp.statusText}`);
+    }
+    state.series = await resp.json();
+    setStatus(`${state.series.length} series`);
+    renderPicker();
+  } catch (err) {
+    setStatus(`Error loading series: ${err.message}`, true);
+  }
+}
+
+function renderPicker() {
+  const filter = $("filter").value.toLowerCase();
+  const items = [];
+  for (const series of state.series) {
+    if (filter && !series.id.toLowerCase().includes(filter)) {
+      continue;
+    }
+    const selected = state.selected.has(series.id);
+
+    const li = document.createElement("li");
+    li.classList.toggle("selected", selected);
+
+    const id = document.createElement("div");
+    id.className = "id";
+    id.textContent = `[${selected ? "x" : " "}] ${series.id}`;
+
+    const help = document.createElement("div");
+    help.className = "help";
+    help.textContent = series.help || "";
+
+    li.append(id, help);
+    li.addEventListener("click", () => toggleSelected(series.id));
+    items.push(li);
+  }
+  $("metrics").replaceChildren(...items);
+  $("graph").disabled = state.selected.size === 0;
+}
+
+function toggleSelected(id) {
+  if (state.selected.has(id)) {
+    state.selected.delete(id);
+  } else {
+    state.selected.add(id);
+  }
+  renderPicker();
+}
+
+// ---- Dashboard ----
+
+function showDashboard() {
+  if (state.selected.size === 0) {
+    return;
+  }
+  $("picker").hidden = true;
+  $("dashboard").hidden = false;
+
+  const template = $("cell-template");
+  const cells = [];
+  state.graphs = new Map();
+  let i = 0;
+  for (const id of state.selected) {
+    const cell = template.content.firstElementChild.cloneNode(true);
+    const color = chartColors[i % chartColors.length];
+    cell.style.color = color;
+    const series = state.series.find((series) => series.id === id);
+    state.graphs.set(id, {
+      id,
+      color,
+      counter: series !== undefined && (series.type || "").toUpperCase() === "COUNTER",
+      points: [],
+      title: cell.querySelector(".title"),
+      basic: cell.querySelector(".basic"),
+      advanced: cell.querySelector(".advanced"),
+      canvas: cell.querySelector("canvas"),
+    });
+    cells.push(cell);
+    i++;
+  }
+  $("grid").replaceChildren(...cells);
+  $("summary").textContent = `Metrics: ${state.graphs.size}`;
+
+  for (const graph of state.graphs.values()) {
+    renderGraph(graph);
+  }
+  connectStream();
+}
+
+function showPicker() {
+  if (state.source) {
+    state.source.close();
+    state.source = null;
+  }
+  $("dashboard").hidden = true;
+  $("picker").hidden = false;
+  loadSeries();
+  $("filter").focus();
+}
+
+function connectStream() {
+  if (state.source) {
+    state.source.close();
+  }
+  // Filter server-side by family name; events are routed by id below
+  const names = new Set();
+  for (const series of state.series) {
+    if (state.graphs.has(series.id)) {
+      names.add(series.name);
+    }
+  }
+  const params = new URLSearchParams();
+  for (const name of names) {
+    params.append("metric", name);
+  }
+
+  const source = new EventSource(`api/stream?${params}`);
+  source.onopen = () => setStatus("Streaming");
+  source.onerror = () => setStatus("Stream disconnected, retrying…", true);
+  source.onmessage = (e) => {
+    const event = JSON.parse(e.data);
+    const graph = state.graphs.get(event.id);
+    // Failed scrapes are null, kept as gaps, and infinities are the strings
+    // "+Inf" and "-Inf", which can't be plotted
+    if (!graph || (event.value !== null && typeof event.value !== "number")) {
+      return;
+    }
+    const t = Date.parse(event.timestamp);
+    // A reconnect replays the backfill; skip samples we already have
+    const last = graph.points[graph.points.length - 1];
+    if (last && t <= last.t) {
+      return;
+    }
+    graph.points.push({ t, v: event.value });
+    if (graph.points.length > MAX_POINTS) {
+      graph.points.shift();
+    }
+    graph.dirty = true;
+    scheduleDraw();
+    setStatus(`Last sample: ${new Date(t).toLocaleTimeString()}`);
+  };
+  state.source = source;
+}
+
+function scheduleDraw() {
+  if (state.drawPending) {
+    return;
+  }
+  state.drawPending = true;
+  requestAnimationFrame(() => {
+    state.drawPending = false;
+    for (const graph of state.graphs.values()) {
+      if (graph.dirty) {
+        graph.dirty = false;
+        renderGraph(graph);
+      }
+    }
+  });
+}
+
+// ---- Statistics, matching internal/buffer.TimestampedBuffer ----
+// Points are {t, v} with t in milliseconds, and v null for a failed scrape.
+
+// percentile returns the value at percentile p (0-100), weighting each
+// value by how long it was current: the time until the next point or gap.
+// The latest value is weighted by the average of the others.
+function percentile(points, p) {
+  const values = [];
+  let total = 0;
+  let last = -1;
+  for (let i = 0; i < points.length; i++) {
+    if (points[i].v === null) {
+      continue;
+    }
+    if (i === points.length - 1) {
+      last = values.length;
+      values.push({ v: points[i].v, w: 0 });
+      continue;
+    }
+    const w = (points[i + 1].t - points[i].t) / 1000;
+    values.push({ v: points[i].v, w });
+    total += w;
+  }
+  if (last >= 0 && values.length > 1) {
+    values[last].w = total / (values.length - 1);
+    total += values[last].w;
+  }
+  if (total <= 0) {
+    // No elapsed time to weight by, so count every value equally
+    for (const value of values) {
+      value.w = 1;
+    }
+    total = values.length;
+  }
+
+  values.sort((a, b) => a.v - b.v);
+  const target = (p / 100) * total;
+  let cumulative = 0;
+  for (const value of values) {
+    cumulative += value.w;
+    if (value.w > 0 && cumulative >= target) {
+      return value.v;
+    }
+  }
+  return values[values.length - 1].v;
+}
+
+// trend is 1 (up), -1 (down) or 0 (flat) from the least squares slope of
+// the values over time, flat unless the slope accounts for a change of more
+// than 5% of the average (minimum 0.01) over the window
+function trend(valid) {
+  const n = valid.length;
+  if (n < 2) {
+    return 0;
+  }
+  const start = valid[0].t;
+  const span = (valid[n - 1].t - start) / 1000;
+  if (span <= 0) {
+    return 0;
+  }
+  const xs = valid.map((p) => (p.t - start) / 1000);
+  const meanX = xs.reduce((a, b) => a + b, 0) / n;
+  const meanY = valid.reduce((a, p) => a + p.v, 0) / n;
+  let cov = 0;
+  let varX = 0;
+  for (let i = 0; i < n; i++) {
+    const dx = xs[i] - meanX;
+    cov += dx * (valid[i].v - meanY);
+    varX += dx * dx;
+  }
+  const change = (cov / varX) * span;
+  const threshold = Math.max(Math.abs(meanY) * 0.05, 0.01);
+  if (change > threshold) {
+    return 1;
+  } else if (change < -threshold) {
+    return -1;
+  }
+  return 0;
+}
+
+// computeStats returns the statistics of the points, or null if every
+// scrape failed
+function computeStats(points, counter) {
+  const valid = points.filter((p) => p.v !== null);
+  const values = valid.map((p) => p.v);
+  const n = values.length;
+  if (n === 0) {
+    return null;
+  }
+  const avg = values.reduce((a, b) => a + b, 0) / n;
+  const stddev = Math.sqrt(values.reduce((a, v) => a + (v - avg) ** 2, 0) / n);
+  const stats = {
+    latest: values[n - 1],
+    min: Math.min(...values),
+    max: Math.max(...values),
+    avg,
+    median: percentile(points, 50),
+    p95: percentile(points, 95),
+    stddev,
+    cv: avg !== 0 ? stddev / avg : null,
+    rate: null,
+    trend: trend(valid),
+  };
+  if (n >= 2) {
+    const elapsed = (valid[n - 1].t - valid[0].t) / 1000;
+    if (elapsed > 0) {
+      stats.rate = (counter ? counterIncrease(values) : values[n - 1] - values[0]) / elapsed;
+    }
+  }
+  return stats;
+}
+
+// counterIncrease adds up how much a counter increased, taking any decrease
+// as a reset to zero like prometheus and the server do
+function counterIncrease(values) {
+  let increase = 0;
+  for (let i = 1; i < values.length; i++) {
+    increase += values[i] < values[i - 1] ? values[i] : values[i] - values[i - 1];
+  }
+  return increase;
+}
+
+// ---- Rendering ----
+
+function trendArrow(direction) {
+  const arrow = document.createElement("span");
+  if (direction === 1) {
+    arrow.className = "trend-up";
+    arrow.textContent = "↑";
+  } else if (direction === -1) {
+    arrow.className = "trend-down";
+    arrow.textContent = "↓";
+  } else {
+    arrow.className = "trend-flat";
+    arrow.textContent = "→";
+  }
+  return arrow;
+}
+
+function renderGraph(graph) {
+  const s = computeStats(graph.points, graph.counter);
+  if (s === null) {
+    graph.title.textContent = `${graph.id}: (no data)`;
+    graph.basic.textContent = "";
+    graph.advanced.textContent = "";
+  } else {
+    graph.title.replaceChildren(`${graph.id}: ${s.latest.toFixed(2)} `, trendArrow(s.trend));
+    graph.basic.textContent =
+      `min: ${s.min.toFixed(1)} | max: ${s.max.toFixed(1)} | avg: ${s.avg.toFixed(1)} | med: ${s.median.toFixed(1)}`;
+
+    const advanced = [`σ: ${s.stddev.toFixed(2)}`];
+    if (s.cv !== null) {
+      advanced.push(`cv: ${s.cv.toFixed(2)}`);
+    }
+    advanced.push(`p95: ${s.p95.toFixed(1)}`);
+    if (s.rate !== null) {
+      advanced.push(`rate: ${s.rate >= 0 ? "+" : ""}${s.rate.toFixed(2)}/s`);
+    }
+    graph.advanced.textContent = advanced.join(" | ");
+  }
+  drawChart(graph.canvas, graph.points, graph.color);
+}
+
+function formatTime(t) {
+  return new Date(t).toLocaleTimeString([], { hour12: false });
+}
+
+function formatValue(v) {
+  const abs = Math.abs(v);
+  if (abs !== 0 && (abs >= 1e6 || abs < 1e-2)) {
+    return v.toExponential(2);
+  }
+  return v.toFixed(2);
+}
+
+function drawChart(canvas, points, color) {
+  const dpr = window.devicePixelRatio || 1;
+  const width = canvas.clientWidth;
+  const height = canvas.clientHeight;
+  canvas.width = width * dpr;
+  canvas.height = height * dpr;
+
+  const ctx = canvas.getContext("2d");
+  ctx.scale(dpr, dpr);
+  ctx.clearRect(0, 0, width, height);
+  ctx.font = "11px ui-monospace, monospace";
+
+  const left = 70;
+  const bottom = 18;
+  const plotWidth = width - left - 4;
+  const plotHeight = height - bottom - 4;
+
+  // Axes
+  ctx.strokeStyle = "#888888";
+  ctx.beginPath();
+  ctx.moveTo(left, 4);
+  ctx.lineTo(left, 4 + plotHeight);
+  ctx.lineTo(left + plotWidth, 4 + plotHeight);
+  ctx.stroke();
+
+  const values = points.filter((p) => p.v !== null).map((p) => p.v);
+  if (values.length === 0) {
+    return;
+  }
+
+  let minV = Math.min(...values);
+  let maxV = Math.max(...values);
+  if (minV === maxV) {
+    minV -= 1;
+    maxV += 1;
+  }
+  const minT = points[0].t;
+  const maxT = Math.max(points[points.length - 1].t, minT + 1);
+
+  const x = (t) => left + ((t - minT) / (maxT - minT)) * plotWidth;
+  const y = (v) => 4 + plotHeight - ((v - minV) / (maxV - minV)) * plotHeight;
+
+  // Horizontal grid lines with Y labels
+  const gridLines = 4;
+  ctx.fillStyle = "#888888";
+  ctx.textAlign = "right";
+  ctx.textBaseline = "middle";
+  for (let i = 0; i <= gridLines; i++) {
+    const v = minV + ((maxV - minV) * i) / gridLines;
+    const gy = y(v);
+    ctx.fillText(formatValue(v), left - 4, gy);
+    if (i > 0) {
+      ctx.strokeStyle = "#444444";
+      ctx.setLineDash([1, 3]);
+      ctx.beginPath();
+      ctx.moveTo(left + 1, gy);
+      ctx.lineTo(left + plotWidth, gy);
+      ctx.stroke();
+      ctx.setLineDash([]);
+    }
+  }
+
+  // X labels at both ends of the window
+  ctx.textBaseline = "top";
+  ctx.textAlign = "left";
+  ctx.fillText(formatTime(minT), left, 4 + plotHeight + 3);
+  ctx.textAlign = "right";
+  ctx.fillText(formatTime(maxT), left + plotWidth, 4 + plotHeight + 3);
+
+  // Data line, broken wherever a scrape failed
+  ctx.strokeStyle = color;
+  ctx.lineWidth = 1.5;
+  ctx.beginPath();
+  let drawing = false;
+  for (const p of points) {
+    if (p.v === null) {
+      drawing = false;
+      continue;
+    }
+    if (drawing) {
+      ctx.lineTo(x(p.t), y(p.v));
+    } else {
+      ctx.moveTo(x(p.t), y(p.v));
+    }
+    drawing = true;
+  }
+  ctx.stroke();
+}
+
+// ---- Wiring ----
+
+$("filter").addEventListener("input", renderPicker);
+$("refresh").addEventListener("click", loadSeries);
+$("graph").addEventListener("click", showDashboard);
+$("back").addEventListener("click", showPicker);
+
+document.addEventListener("keydown", (e) => {
+  if (!$("picker").hidden && e.key === "Enter") {
+    showDashboard();
+  } else if (!$("dashboard").hidden && e.key === "Escape") {
+    showPicker();
+  }
+});
+
+window.addEventListener("resize", () => {
+  for (const graph of state.graphs.values()) {
+    drawChart(graph.canvas, graph.points, graph.color);
+  }
+});
+
+loadSeries();
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUI_ServesDashboard(t *testing.T) {
+	s := New(nil, time.Second, 10)
+
+	for path, contentType := range map[string]string{
+		"/":          "text/html",
+		"/app.js":    "text/javascript",
+		"/style.css": "text/css",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, rec.Code)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentType) {
+			t.Errorf("%s: expected content type %s, got %q", path, contentType, ct)
+		}
+	}
+}
+
+func TestUI_NoExternalAssets(t *testing.T) {
+	// The dashboard must work offline, so nothing may be loaded from another host
+	external := regexp.MustCompile(`(src|href)=["']?(https?:)?//|url\(["']?(https?:)?//|import\s.*["']https?:`)
+
+	entries, err := uiFiles.ReadDir("ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := uiFiles.ReadFile("ui/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc := external.FindIndex(data); loc != nil {
+			t.Errorf("%s references an external asset: %s", entry.Name(), data[loc[0]:loc[1]])
+		}
+	}
+}
+
+func TestUI_APIRoutesTakePrecedence(t *testing.T) {
+	s := New(nil, time.Second, 10)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/series", nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected /api/series to return JSON, got %q", ct)
+	}
+}